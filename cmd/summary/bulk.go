@@ -0,0 +1,398 @@
+package main
+
+import (
+	"Assignment1Summary/summary"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//bulkConfig configures a bulk run.
+type bulkConfig struct {
+	//input is the CSV or JSONL file of URLs.
+	input string
+	//output is the CSV or JSONL file the results are appended to.
+	output string
+	//checkpoint is the file recording which rows are done.
+	checkpoint string
+	//concurrency is how many URLs are summarized at once.
+	concurrency int
+	//perHost is how many URLs of the same host are summarized at once.
+	perHost int
+	//hostDelay is the least time between starting requests to the same host.
+	hostDelay time.Duration
+	//timeout is the time limit for summarizing each URL.
+	timeout time.Duration
+}
+
+//bulkRow is a URL read from a bulk input file.
+type bulkRow struct {
+	//Row is the 1-based number of the row in the input,
+	//not counting a CSV header.
+	Row int    `json:"row"`
+	URL string `json:"url"`
+}
+
+//bulkResult is the result of summarizing a bulkRow.
+type bulkResult struct {
+	bulkRow
+	Summary *summary.PageSummary `json:"summary,omitempty"`
+	Error   string               `json:"error,omitempty"`
+}
+
+//runBulk summarizes the URLs in the input file, appending the results
+//to the output file as they finish and recording the finished rows in
+//the checkpoint file. Rows already in the checkpoint are skipped, so an
+//interrupted run resumes where it left off. When `ctx` is done, no new
+//URLs are started, and unfinished ones are left for the next run.
+func runBulk(ctx context.Context, fetcher *summary.Fetcher, opts *summary.Options, config *bulkConfig) error {
+	ctx = summary.WithBatch(ctx)
+	rows, err := readBulkInput(config.input)
+	if err != nil {
+		return err
+	}
+	done, err := readCheckpoint(config.checkpoint)
+	if err != nil {
+		return err
+	}
+	out, err := newResultWriter(config.output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	checkpoint, err := os.OpenFile(config.checkpoint, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer checkpoint.Close()
+
+	limiter := newHostLimiter(config.perHost, config.hostDelay)
+	todo := make(chan bulkRow)
+	results := make(chan *bulkResult)
+	var workers sync.WaitGroup
+	for i := 0; i < config.concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for row := range todo {
+				if result := summarizeRow(ctx, fetcher, opts, limiter, config.timeout, row); result != nil {
+					results <- result
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(todo)
+		for _, row := range rows {
+			if done[row.Row] {
+				continue
+			}
+			select {
+			case todo <- row:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	var writeErr error
+	for result := range results {
+		if writeErr != nil {
+			//keep draining so the workers can finish
+			continue
+		}
+		//the result is written before the checkpoint, so a crash between
+		//them repeats the row on the next run rather than losing it
+		if writeErr = out.Write(result); writeErr != nil {
+			continue
+		}
+		_, writeErr = fmt.Fprintln(checkpoint, result.Row)
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return ctx.Err()
+}
+
+//summarizeRow summarizes the URL of `row`, waiting its turn for the
+//host. It returns nil if `ctx` is done first, so that the row is left
+//for the next run rather than recorded as an error.
+func summarizeRow(ctx context.Context, fetcher *summary.Fetcher, opts *summary.Options, limiter *hostLimiter, timeout time.Duration, row bulkRow) *bulkResult {
+	result := &bulkResult{bulkRow: row}
+	u, err := url.Parse(row.URL)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	release, err := limiter.acquire(ctx, strings.ToLower(u.Hostname()))
+	if err != nil {
+		return nil
+	}
+	defer release()
+
+	rowCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result.Summary, err = fetcher.SummarizeWith(rowCtx, row.URL, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		result.Error = err.Error()
+	}
+	return result
+}
+
+//readBulkInput reads the URLs in a .csv or .jsonl input file.
+//Rows with an empty URL are skipped.
+func readBulkInput(path string) ([]bulkRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rows []bulkRow
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		rows, err = readCSVRows(f)
+	case ".jsonl", ".ndjson":
+		rows, err = readJSONLRows(f)
+	default:
+		return nil, fmt.Errorf("%s: the input file must be .csv or .jsonl", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return rows, nil
+}
+
+//readCSVRows reads URLs from CSV. If the first record has a column
+//named "url", it is a header, and the URLs are in that column.
+//Otherwise the URLs are in the first column.
+func readCSVRows(r io.Reader) ([]bulkRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	column := 0
+	if len(records) > 0 {
+		for i, name := range records[0] {
+			if strings.EqualFold(strings.TrimSpace(name), "url") {
+				column = i
+				records = records[1:]
+				break
+			}
+		}
+	}
+	var rows []bulkRow
+	for i, record := range records {
+		if column < len(record) {
+			if u := strings.TrimSpace(record[column]); len(u) > 0 {
+				rows = append(rows, bulkRow{Row: i + 1, URL: u})
+			}
+		}
+	}
+	return rows, nil
+}
+
+//readJSONLRows reads URLs from JSON lines, each an object with a
+//"url" member. Blank lines are skipped, but still counted as rows.
+func readJSONLRows(r io.Reader) ([]bulkRow, error) {
+	var rows []bulkRow
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		record := struct {
+			URL string `json:"url"`
+		}{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if u := strings.TrimSpace(record.URL); len(u) > 0 {
+			rows = append(rows, bulkRow{Row: line, URL: u})
+		}
+	}
+	return rows, scanner.Err()
+}
+
+//readCheckpoint returns the rows recorded as done in the checkpoint
+//file, which has one row number per line. A missing file means no rows
+//are done, and a partly written last line is ignored.
+func readCheckpoint(path string) (map[int]bool, error) {
+	done := map[int]bool{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if row, err := strconv.Atoi(strings.TrimSpace(scanner.Text())); err == nil {
+			done[row] = true
+		}
+	}
+	return done, scanner.Err()
+}
+
+//resultWriter appends results to a .csv or .jsonl output file,
+//flushing each one as it is written.
+type resultWriter struct {
+	f   *os.File
+	csv *csv.Writer
+}
+
+//csvResultHeader is the header of CSV output files.
+var csvResultHeader = []string{"row", "url", "error", "type", "title", "siteName", "description", "author", "keywords", "icon", "image"}
+
+//newResultWriter opens the output file at `path` for appending,
+//writing the CSV header if it is a new CSV file.
+func newResultWriter(path string) (*resultWriter, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".csv" && ext != ".jsonl" && ext != ".ndjson" {
+		return nil, fmt.Errorf("%s: the output file must be .csv or .jsonl", path)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &resultWriter{f: f}
+	if ext == ".csv" {
+		w.csv = csv.NewWriter(f)
+		info, err := f.Stat()
+		if err == nil && info.Size() == 0 {
+			err = w.writeCSV(csvResultHeader)
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+//Write appends `result` to the file.
+func (w *resultWriter) Write(result *bulkResult) error {
+	if w.csv == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		_, err = w.f.Write(append(data, '\n'))
+		return err
+	}
+	record := []string{strconv.Itoa(result.Row), result.URL, result.Error}
+	s := result.Summary
+	if s == nil {
+		s = &summary.PageSummary{}
+	}
+	var icon, image string
+	if s.Icon != nil {
+		icon = s.Icon.URL
+	}
+	if len(s.Images) > 0 {
+		image = s.Images[0].URL
+	}
+	record = append(record, s.Type, s.Title, s.SiteName, s.Description, s.Author,
+		strings.Join(s.Keywords, ", "), icon, image)
+	return w.writeCSV(record)
+}
+
+//writeCSV writes and flushes one CSV record.
+func (w *resultWriter) writeCSV(record []string) error {
+	if err := w.csv.Write(record); err != nil {
+		return err
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+//Close closes the file.
+func (w *resultWriter) Close() error {
+	return w.f.Close()
+}
+
+//hostLimiter limits how many requests are made to each host at once,
+//and how soon after each other they start.
+type hostLimiter struct {
+	perHost int
+	delay   time.Duration
+	mu      sync.Mutex
+	hosts   map[string]*hostSlot
+}
+
+//hostSlot is the state of one host in a hostLimiter.
+type hostSlot struct {
+	active chan struct{}
+	mu     sync.Mutex
+	next   time.Time
+}
+
+//newHostLimiter returns a limiter that allows `perHost` requests to
+//each host at once, started at least `delay` apart.
+func newHostLimiter(perHost int, delay time.Duration) *hostLimiter {
+	if perHost < 1 {
+		perHost = 1
+	}
+	return &hostLimiter{perHost: perHost, delay: delay, hosts: map[string]*hostSlot{}}
+}
+
+//acquire waits until a request to `host` may start, and returns a
+//function to call when it is finished. It returns ctx.Err() if `ctx`
+//is done first.
+func (l *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	l.mu.Lock()
+	slot := l.hosts[host]
+	if slot == nil {
+		slot = &hostSlot{active: make(chan struct{}, l.perHost)}
+		l.hosts[host] = slot
+	}
+	l.mu.Unlock()
+
+	select {
+	case slot.active <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-slot.active }
+
+	//reserve the next start time, then wait for it
+	slot.mu.Lock()
+	start := time.Now()
+	if slot.next.After(start) {
+		start = slot.next
+	}
+	slot.next = start.Add(l.delay)
+	slot.mu.Unlock()
+	if wait := time.Until(start); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
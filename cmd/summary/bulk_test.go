@@ -0,0 +1,181 @@
+package main
+
+import (
+	"Assignment1Summary/summary"
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadBulkInput(t *testing.T) {
+	cases := []struct {
+		name     string
+		hint     string
+		input    string
+		csv      bool
+		expected []bulkRow
+	}{
+		{
+			"CSV With Header",
+			"the URLs should be read from the url column, and rows numbered after the header",
+			"name,URL\nHome,https://a.test/\nEmpty,\nAbout, https://a.test/about \n",
+			true,
+			[]bulkRow{{1, "https://a.test/"}, {3, "https://a.test/about"}},
+		},
+		{
+			"CSV Without Header",
+			"without a header, the URLs should be read from the first column",
+			"https://a.test/,Home\nhttps://b.test/\n",
+			true,
+			[]bulkRow{{1, "https://a.test/"}, {2, "https://b.test/"}},
+		},
+		{
+			"JSONL",
+			"each line should be an object with a url, and blank lines should still be counted",
+			`{"url": "https://a.test/", "team": "docs"}` + "\n\n" + `{"url": "https://b.test/"}` + "\n",
+			false,
+			[]bulkRow{{1, "https://a.test/"}, {3, "https://b.test/"}},
+		},
+	}
+	for _, c := range cases {
+		var rows []bulkRow
+		var err error
+		if c.csv {
+			rows, err = readCSVRows(strings.NewReader(c.input))
+		} else {
+			rows, err = readJSONLRows(strings.NewReader(c.input))
+		}
+		if err != nil {
+			t.Errorf("case %s: unexpected error %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(rows, c.expected) {
+			t.Errorf("case %s: expected %v but got %v\nHINT: %s", c.name, c.expected, rows, c.hint)
+		}
+	}
+
+	if _, err := readJSONLRows(strings.NewReader("{\"url\": \"https://a.test/\"}\nnot json\n")); err == nil {
+		t.Errorf("expected an error reading invalid JSON lines")
+	}
+}
+
+func TestRunBulk(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>Page " + r.URL.Path + "</title></head></html>"))
+	}))
+	defer server.Close()
+
+	dir, err := os.MkdirTemp("", "bulk")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	config := &bulkConfig{
+		input:       filepath.Join(dir, "urls.csv"),
+		output:      filepath.Join(dir, "results.jsonl"),
+		checkpoint:  filepath.Join(dir, "results.jsonl.checkpoint"),
+		concurrency: 2,
+		perHost:     2,
+		timeout:     5 * time.Second,
+	}
+	input := "url\n" + server.URL + "/one\n" + server.URL + "/two\n" + server.URL + "/missing\n"
+	if err := os.WriteFile(config.input, []byte(input), 0644); err != nil {
+		t.Fatalf("error writing input: %v", err)
+	}
+	//a previous run finished the first row
+	if err := os.WriteFile(config.checkpoint, []byte("1\n"), 0644); err != nil {
+		t.Fatalf("error writing checkpoint: %v", err)
+	}
+
+	fetcher := summary.NewFetcher()
+	fetcher.AllowPrivateAddresses = true
+	readResults := func() map[int]*bulkResult {
+		f, err := os.Open(config.output)
+		if err != nil {
+			t.Fatalf("error opening output: %v", err)
+		}
+		defer f.Close()
+		results := map[int]*bulkResult{}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			result := &bulkResult{}
+			if err := json.Unmarshal(scanner.Bytes(), result); err != nil {
+				t.Fatalf("error decoding result %q: %v", scanner.Text(), err)
+			}
+			if results[result.Row] != nil {
+				t.Errorf("row %d was written more than once", result.Row)
+			}
+			results[result.Row] = result
+		}
+		return results
+	}
+
+	if err := runBulk(context.Background(), fetcher, fetcher.Options(), config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results := readResults()
+	if len(results) != 2 || results[1] != nil {
+		t.Errorf("expected only rows 2 and 3 to be summarized, since row 1 was checkpointed, but got %d rows", len(results))
+	}
+	if r := results[2]; r == nil || r.Summary == nil || r.Summary.Title != "Page /two" {
+		t.Errorf("expected row 2 to have the title %q but got %+v", "Page /two", r)
+	}
+	if r := results[3]; r == nil || len(r.Error) == 0 {
+		t.Errorf("expected row 3 to have an error but got %+v", r)
+	}
+
+	//running again should resume with nothing left to do
+	if err := runBulk(context.Background(), fetcher, fetcher.Options(), config); err != nil {
+		t.Fatalf("unexpected error resuming: %v", err)
+	}
+	if results := readResults(); len(results) != 2 {
+		t.Errorf("expected a resumed run not to repeat rows, but got %d rows", len(results))
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	limiter := newHostLimiter(1, delay)
+	ctx := context.Background()
+
+	start := time.Now()
+	release, err := limiter.acquire(ctx, "a.test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	release()
+	if release, err = limiter.acquire(ctx, "b.test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	release()
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Errorf("expected different hosts not to wait for each other, but waited %v", elapsed)
+	}
+	if release, err = limiter.acquire(ctx, "a.test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("expected the second request to a host to wait %v, but it waited %v", delay, elapsed)
+	}
+
+	//the host is busy, so this should wait until the context is done
+	cancelled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquire(cancelled, "a.test"); err == nil {
+		t.Errorf("expected an error when the context is done before the host is free")
+	}
+	release()
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"Assignment1Summary/summary"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+//printer prints page summaries in some format.
+type printer interface {
+	//Print prints the summary of `input`.
+	Print(input string, pageSummary *summary.PageSummary) error
+}
+
+//newPrinter returns a printer that writes `format` to `w`.
+func newPrinter(format string, w io.Writer) (printer, error) {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return &jsonPrinter{encoder}, nil
+	case "yaml":
+		return &yamlPrinter{w: w}, nil
+	case "table":
+		return &tablePrinter{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+//jsonPrinter prints each summary as an indented JSON object,
+//just as the gateway would return it.
+type jsonPrinter struct {
+	encoder *json.Encoder
+}
+
+func (p *jsonPrinter) Print(input string, pageSummary *summary.PageSummary) error {
+	return p.encoder.Encode(pageSummary)
+}
+
+//yamlPrinter prints each summary as a YAML document,
+//with the same field names as the JSON.
+type yamlPrinter struct {
+	w       io.Writer
+	printed bool
+}
+
+func (p *yamlPrinter) Print(input string, pageSummary *summary.PageSummary) error {
+	data, err := json.Marshal(pageSummary)
+	if err != nil {
+		return err
+	}
+	//decode the JSON rather than the struct, so the YAML
+	//has the same field names, order and omitted fields
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	value, err := decodeOrdered(decoder)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if p.printed {
+		buf.WriteString("---\n")
+	}
+	p.printed = true
+	for _, line := range yamlLines(value) {
+		buf.WriteString(line + "\n")
+	}
+	_, err = p.w.Write(buf.Bytes())
+	return err
+}
+
+//orderedObject is a JSON object whose members are kept in order.
+type orderedObject []*member
+
+//member is a member of an orderedObject.
+type member struct {
+	key   string
+	value interface{}
+}
+
+//decodeOrdered decodes the next JSON value from `decoder`, decoding
+//objects as orderedObjects, arrays as []interface{}, and scalars as
+//the decoder's tokens.
+func decodeOrdered(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		object := orderedObject{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, &member{key.(string), value})
+		}
+		_, err := decoder.Token()
+		return object, err
+	case json.Delim('['):
+		array := []interface{}{}
+		for decoder.More() {
+			value, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err := decoder.Token()
+		return array, err
+	}
+	return token, nil
+}
+
+//yamlLines returns the YAML lines for `value`, indented relative
+//to the enclosing block.
+func yamlLines(value interface{}) []string {
+	var lines []string
+	switch v := value.(type) {
+	case orderedObject:
+		if len(v) == 0 {
+			return []string{"{}"}
+		}
+		for _, m := range v {
+			lines = append(lines, yamlBlock(yamlString(m.key)+":", m.value, "  ")...)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return []string{"[]"}
+		}
+		for _, item := range v {
+			lines = append(lines, yamlBlock("-", item, "  ")...)
+		}
+	default:
+		lines = []string{yamlScalar(v)}
+	}
+	return lines
+}
+
+//yamlBlock returns the lines for `value` after `prefix`, such as a key
+//or a list item's dash. Scalars go on the same line, while objects and
+//arrays go on the following lines, indented by `indent`. The first
+//member of an object in an array goes on the dash's line.
+func yamlBlock(prefix string, value interface{}, indent string) []string {
+	sub := yamlLines(value)
+	nested := false
+	switch v := value.(type) {
+	case orderedObject:
+		nested = len(v) > 0
+	case []interface{}:
+		nested = len(v) > 0
+	}
+	if !nested {
+		return []string{prefix + " " + sub[0]}
+	}
+	var lines []string
+	if _, isObject := value.(orderedObject); isObject && prefix == "-" {
+		lines = append(lines, "- "+sub[0])
+		sub = sub[1:]
+	} else {
+		lines = append(lines, prefix)
+	}
+	for _, line := range sub {
+		lines = append(lines, indent+line)
+	}
+	return lines
+}
+
+//yamlScalar formats a JSON scalar token as YAML.
+func yamlScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case string:
+		return yamlString(v)
+	}
+	return fmt.Sprint(value)
+}
+
+//plainYAML matches strings that YAML reads as strings without quotes.
+//Strings starting with a digit are quoted, since some are read as
+//numbers or dates.
+var plainYAML = regexp.MustCompile(`^[\pL/.(][^\x00-\x1f"#'\x7f]*$`)
+
+//yamlReserved are plain scalars that YAML reads as something other than
+//a string, or that older parsers do.
+var yamlReserved = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true,
+	"off": true, "y": true, "n": true, "null": true, "~": true,
+}
+
+//yamlString formats `s` as a plain YAML scalar if that reads back as
+//the same string, or as a double-quoted one.
+func yamlString(s string) string {
+	if plainYAML.MatchString(s) && !yamlReserved[strings.ToLower(s)] &&
+		!strings.Contains(s, ": ") && !strings.HasSuffix(s, ":") &&
+		strings.TrimSpace(s) == s {
+		return s
+	}
+	//a JSON string is also a valid YAML double-quoted scalar
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+//tablePrinter prints each summary as a table of fields and values,
+//followed by a blank line. If the summary has provenance, a third
+//column shows where each value came from, and the alternatives are
+//listed below the chosen value.
+type tablePrinter struct {
+	w io.Writer
+}
+
+func (p *tablePrinter) Print(input string, pageSummary *summary.PageSummary) error {
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	row := func(field summary.Field, values ...string) {
+		var source string
+		var alternatives []*summary.Candidate
+		if fp := pageSummary.Provenance[field]; fp != nil {
+			source = fp.Source + " " + fp.Tag
+			alternatives = fp.Alternatives
+		}
+		for i, value := range values {
+			if i > 0 {
+				//only the first of several values has a source,
+				//since the rest usually come from the same one
+				source = ""
+			}
+			writeTableRow(tw, pageSummary, string(field), value, source)
+		}
+		for _, alt := range alternatives {
+			writeTableRow(tw, pageSummary, "", "(alternative) "+candidateValue(alt), alt.Source+" "+alt.Tag)
+		}
+	}
+
+	writeTableRow(tw, pageSummary, "input", input, "")
+	stringRow := func(field summary.Field, value string) {
+		if len(value) > 0 {
+			row(field, value)
+		}
+	}
+	stringRow(summary.FieldType, pageSummary.Type)
+	stringRow(summary.FieldURL, pageSummary.URL)
+	stringRow(summary.FieldTitle, pageSummary.Title)
+	stringRow(summary.FieldSiteName, pageSummary.SiteName)
+	stringRow(summary.FieldDescription, pageSummary.Description)
+	stringRow(summary.FieldAuthor, pageSummary.Author)
+	if len(pageSummary.Keywords) > 0 {
+		row(summary.FieldKeywords, strings.Join(pageSummary.Keywords, ", "))
+	}
+	if pageSummary.Icon != nil {
+		row(summary.FieldIcon, imageDescription(pageSummary.Icon))
+	}
+	if len(pageSummary.Images) > 0 {
+		var images []string
+		for _, img := range pageSummary.Images {
+			images = append(images, imageDescription(img))
+		}
+		row(summary.FieldImages, images...)
+	}
+	stringRow("contentType", pageSummary.ContentType)
+	if pageSummary.Size > 0 {
+		stringRow("size", strconv.FormatInt(pageSummary.Size, 10))
+	}
+	stringRow("created", pageSummary.Created)
+	if pageSummary.PageCount > 0 {
+		stringRow("pageCount", strconv.Itoa(pageSummary.PageCount))
+	}
+	var names []string
+	for name := range pageSummary.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		row(summary.Field("values."+name), pageSummary.Values[name]...)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(p.w)
+	return err
+}
+
+//writeTableRow writes one row of the table, with the source column
+//only if the summary has provenance.
+func writeTableRow(w io.Writer, pageSummary *summary.PageSummary, field string, value string, source string) {
+	//keep each value on one line
+	value = strings.Join(strings.Fields(value), " ")
+	if pageSummary.Provenance != nil {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", field, value, source)
+	} else {
+		fmt.Fprintf(w, "%s\t%s\n", field, value)
+	}
+}
+
+//imageDescription describes an image by its URL and any known
+//dimensions and type.
+func imageDescription(img *summary.PreviewImage) string {
+	var details []string
+	if img.Width > 0 && img.Height > 0 {
+		details = append(details, fmt.Sprintf("%dx%d", img.Width, img.Height))
+	}
+	if len(img.Type) > 0 {
+		details = append(details, img.Type)
+	}
+	if len(details) == 0 {
+		return img.URL
+	}
+	return img.URL + " (" + strings.Join(details, ", ") + ")"
+}
+
+//candidateValue returns the value of an alternative candidate.
+func candidateValue(c *summary.Candidate) string {
+	switch {
+	case c.Image != nil:
+		return imageDescription(c.Image)
+	case len(c.Keywords) > 0:
+		return strings.Join(c.Keywords, ", ")
+	}
+	return c.Value
+}
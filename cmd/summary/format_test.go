@@ -0,0 +1,83 @@
+package main
+
+import (
+	"Assignment1Summary/summary"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPrinters(t *testing.T) {
+	const page = `<html><head>
+		<meta property="og:title" content="OG Title">
+		<title>HTML Title</title>
+		<meta name="description" content="yes">
+		<meta name="keywords" content="go, yaml: test">
+		<meta property="og:image" content="/a.png">
+		<meta property="og:image:width" content="300">
+		<meta property="og:image:height" content="200">
+		</head></html>`
+	pageSummary, err := summary.Extract(context.Background(), strings.NewReader(page), "https://test.com/", &summary.Options{Provenance: true})
+	if err != nil {
+		t.Fatalf("unexpected error extracting: %v", err)
+	}
+	pageSummary.Size = 1024
+	pageSummary.Created = "2020-01-02"
+
+	cases := []struct {
+		name     string
+		hint     string
+		format   string
+		expected []string
+	}{
+		{
+			"YAML",
+			"the YAML should have the JSON field names, and quote values that would read back as something else",
+			"yaml",
+			[]string{
+				"title: OG Title\n",
+				"description: \"yes\"\n",
+				"keywords:\n  - go\n  - \"yaml: test\"\n",
+				"images:\n  - url: https://test.com/a.png\n    width: 300\n    height: 200\n",
+				"size: 1024\n",
+				"created: \"2020-01-02\"\n",
+				"provenance:\n  description:\n    source: html\n",
+			},
+		},
+		{
+			"Table",
+			"the table should have a row per field, with sources and alternatives when there is provenance",
+			"table",
+			[]string{
+				"input",
+				"title",
+				"OG Title",
+				"opengraph meta[property=\"og:title\"]",
+				"(alternative) HTML Title",
+				"https://test.com/a.png (300x200)",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		p, err := newPrinter(c.format, buf)
+		if err != nil {
+			t.Fatalf("case %s: unexpected error %v", c.name, err)
+		}
+		if err := p.Print("test.html", pageSummary); err != nil {
+			t.Errorf("case %s: unexpected error printing: %v", c.name, err)
+			continue
+		}
+		for _, expected := range c.expected {
+			if !strings.Contains(buf.String(), expected) {
+				t.Errorf("case %s: expected output to contain %q\nOUTPUT:\n%s\nHINT: %s", c.name, expected, buf.String(), c.hint)
+			}
+		}
+	}
+
+	if _, err := newPrinter("xml", &bytes.Buffer{}); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
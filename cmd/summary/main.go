@@ -0,0 +1,209 @@
+//Command summary prints the summary meta-data of web pages, using the
+//same extraction code as the gateway. It is meant for debugging
+//extraction problems without running the gateway.
+//
+//Usage:
+//
+//  summary [flags] [url|file|-]...
+//
+//Each argument is an http or https URL to fetch, or a local HTML file.
+//With no arguments, or an argument of "-", the HTML is read from stdin.
+//The summaries are printed as JSON, YAML or a table.
+//
+//In bulk mode, the URLs are read from a CSV or JSONL file instead:
+//
+//  summary -bulk urls.csv -out results.jsonl [flags]
+//
+//A CSV file has the URLs in its "url" column, or its first column if it
+//has no header, and a JSONL file has an object with a "url" member on
+//each line. The results are appended to the output file, CSV or JSONL,
+//as they finish. The rows that are done are recorded in a checkpoint
+//file, so that an interrupted run can be resumed by running the same
+//command again.
+//
+//In crawl mode, the pages in a site's sitemaps are summarized, and a
+//JSON report lists the pages missing Open Graph meta-data:
+//
+//  summary -crawl https://example.com/ [flags]
+package main
+
+import (
+	"Assignment1Summary/summary"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func main() {
+	format := flag.String("format", "json", "output `format`: json, yaml or table")
+	timeout := flag.Duration("timeout", 30*time.Second, "time limit for summarizing each input")
+	userAgent := flag.String("user-agent", summary.DefaultUserAgent, "User-Agent header to send when fetching URLs; its product token is matched against robots.txt")
+	robots := flag.String("robots", "batch", "when to obey robots.txt: always, batch (only in bulk and crawl modes) or never")
+	extractors := flag.String("extractors", "", "comma-separated `names` of the extractors to use, in order of precedence;\n"+
+		"each falls back on the next for the fields it doesn't find (default "+strings.Join(summary.DefaultRegistry().Names(), ",")+")")
+	rulesPath := flag.String("rules", "", "site-specific extraction rules `file`, which take precedence over the extractors")
+	baseURL := flag.String("base", "", "base `URL` for resolving relative URLs in files and stdin")
+	debug := flag.String("debug", "", "debug `mode`: provenance includes where each field came from")
+	retries := flag.Int("retries", 2, "how many times to retry fetching a URL after a transient failure, such as a 503 response")
+	allowPrivate := flag.Bool("allow-private", false, "allow fetching from loopback and private addresses")
+	crawl := flag.String("crawl", "", "summarize the pages in the sitemaps of the site at `URL`, and report those missing Open Graph meta-data")
+	bulk := &bulkConfig{}
+	flag.StringVar(&bulk.input, "bulk", "", "summarize the URLs in a .csv or .jsonl `file`")
+	flag.StringVar(&bulk.output, "out", "", "bulk mode: .csv or .jsonl `file` to append the results to")
+	flag.StringVar(&bulk.checkpoint, "checkpoint", "", "bulk mode: `file` recording the rows that are done (default the -out file plus .checkpoint)")
+	flag.IntVar(&bulk.concurrency, "concurrency", 8, "bulk and crawl modes: how many URLs to summarize at once")
+	flag.IntVar(&bulk.perHost, "per-host", 1, "bulk mode: how many URLs of the same host to summarize at once")
+	flag.DurationVar(&bulk.hostDelay, "host-delay", time.Second, "bulk and crawl modes: least time between requests to the same host")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [url|file|-]...\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s -bulk file -out file [flags]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s -crawl url [flags]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	printer, err := newPrinter(*format, os.Stdout)
+	if err != nil {
+		fatal(err)
+	}
+
+	fetcher := summary.NewFetcher()
+	fetcher.UserAgent = *userAgent
+	if fetcher.Robots, err = summary.ParseRobotsMode(*robots); err != nil {
+		fatal(err)
+	}
+	fetcher.AllowPrivateAddresses = *allowPrivate
+	fetcher.Retries = *retries
+	registry := summary.DefaultRegistry()
+	if len(*extractors) > 0 {
+		names := strings.Split(*extractors, ",")
+		for i := range names {
+			names[i] = strings.TrimSpace(names[i])
+		}
+		if err := registry.Use(names...); err != nil {
+			fatal(err)
+		}
+	}
+	if len(*rulesPath) > 0 {
+		rules, err := summary.LoadRulesFile(*rulesPath)
+		if err != nil {
+			fatal(err)
+		}
+		if err := registry.RegisterBefore(registry.Names()[0], rules); err != nil {
+			fatal(err)
+		}
+	}
+	fetcher.Registry = registry
+
+	opts := fetcher.Options()
+	switch *debug {
+	case "":
+	case "provenance":
+		opts.Provenance = true
+	default:
+		fatal(fmt.Errorf("unknown debug mode %q", *debug))
+	}
+
+	if len(*crawl) > 0 {
+		crawler := &summary.Crawler{Fetcher: fetcher, Concurrency: bulk.concurrency, Delay: bulk.hostDelay}
+		report, err := crawler.Crawl(interruptible(), *crawl)
+		if report != nil {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(report)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if len(bulk.input) > 0 {
+		if len(bulk.output) == 0 {
+			fatal(fmt.Errorf("bulk mode needs an -out file"))
+		}
+		if len(bulk.checkpoint) == 0 {
+			bulk.checkpoint = bulk.output + ".checkpoint"
+		}
+		if bulk.concurrency < 1 {
+			bulk.concurrency = 1
+		}
+		bulk.timeout = *timeout
+		//stop on an interrupt, leaving the unfinished URLs for the next run
+		if err := runBulk(interruptible(), fetcher, opts, bulk); err == context.Canceled {
+			fmt.Fprintln(os.Stderr, "summary: run the same command again to resume")
+			os.Exit(1)
+		} else if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	inputs := flag.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	failed := false
+	for _, input := range inputs {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		pageSummary, err := summarize(ctx, fetcher, input, *baseURL, opts)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "summary: %s: %v\n", input, err)
+			failed = true
+			continue
+		}
+		if err := printer.Print(input, pageSummary); err != nil {
+			fatal(err)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+//summarize summarizes `input`, which is a URL to fetch, a file name,
+//or "-" for stdin. Files and stdin are parsed as HTML, with relative
+//URLs resolved against `baseURL`.
+func summarize(ctx context.Context, fetcher *summary.Fetcher, input string, baseURL string, opts *summary.Options) (*summary.PageSummary, error) {
+	if strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://") {
+		return fetcher.SummarizeWith(ctx, input, opts)
+	}
+	var r io.Reader = os.Stdin
+	if input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return summary.Extract(ctx, r, baseURL, opts)
+}
+
+//interruptible returns a context that is cancelled when
+//the process is interrupted or terminated.
+func interruptible() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupts
+		fmt.Fprintln(os.Stderr, "summary: interrupted")
+		cancel()
+	}()
+	return ctx
+}
+
+//fatal prints `err` and exits with a non-zero status.
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "summary: %v\n", err)
+	os.Exit(2)
+}
@@ -0,0 +1,32 @@
+//Package testimage creates images for tests.
+package testimage
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+//Encode returns a blank white image of the given size,
+//encoded in `format`, which is "png" or "gif".
+func Encode(t testing.TB, format string, width int, height int) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	img := image.NewPaletted(image.Rect(0, 0, width, height), []color.Color{color.White})
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(buf, img)
+	case "gif":
+		err = gif.Encode(buf, img, nil)
+	default:
+		t.Fatalf("unknown test image format %s", format)
+	}
+	if err != nil {
+		t.Fatalf("error encoding test %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
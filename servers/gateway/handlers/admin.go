@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"Assignment1Summary/summary"
+)
+
+//AdminToken is the bearer token that admin API requests must have
+//in their Authorization header. main sets this from the ADMIN_TOKEN
+//environment variable. If it is empty, the admin API is disabled.
+var AdminToken string
+
+//authorizeAdmin checks that `r` has the admin token, and responds with
+//an error and returns false if it doesn't.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if len(AdminToken) == 0 {
+		http.Error(w, "the admin API is disabled", http.StatusNotFound)
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(AdminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		http.Error(w, "missing or incorrect admin token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+//BreakersHandler handles requests for the state of the upstream
+//hosts' circuit breakers. It responds with a JSON-encoded list of
+//summary.BreakerState, for the hosts that have failed recently.
+func BreakersHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "the breakers API only accepts GET requests", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(Fetcher.Breakers()); err != nil {
+		log.Printf("error encoding the breakers to json: %v", err)
+	}
+}
+
+//purgeResult is the response to a request to purge cached summaries.
+type purgeResult struct {
+	Purged int `json:"purged"`
+}
+
+//CacheHandler handles admin requests for the summary cache. Requests
+//have a `url` query parameter, and:
+//
+//  GET returns the URL's JSON-encoded summary.CacheEntry
+//  POST summarizes the URL again and caches the new summary,
+//    whether or not the cached one is fresh, and returns it
+//  DELETE purges the URL's cached summary
+//
+//A DELETE request may instead have a `host` query parameter with a
+//host pattern, such as "*.example.com", to purge the summaries of
+//every page on the matching hosts. DELETE requests respond with the
+//number of summaries purged, like {"purged": 2}.
+func CacheHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+	if Fetcher.Cache == nil {
+		http.Error(w, "the summary cache is disabled", http.StatusNotFound)
+		return
+	}
+	pageURL := r.URL.Query().Get("url")
+	host := r.URL.Query().Get("host")
+	if len(pageURL) == 0 && (r.Method != http.MethodDelete || len(host) == 0) {
+		http.Error(w, "No url found in the request", http.StatusBadRequest)
+		return
+	}
+	if len(pageURL) == 0 {
+		if err := summary.CheckHostPattern(host); err != nil {
+			http.Error(w, fmt.Sprintf("invalid host pattern: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var result interface{}
+	switch r.Method {
+	case http.MethodGet:
+		entry, err := Fetcher.Cache.Get(r.Context(), pageURL)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error reading the cache: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if entry == nil {
+			http.Error(w, "the url isn't cached", http.StatusNotFound)
+			return
+		}
+		result = entry
+	case http.MethodPost:
+		pageSummary, err := Fetcher.Refresh(r.Context(), pageURL)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error summarizing URL: %v", err), http.StatusBadRequest)
+			return
+		}
+		result = pageSummary
+	case http.MethodDelete:
+		purged, err := purge(r, pageURL, host)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, summary.ErrCacheNotScannable) {
+				status = http.StatusNotImplemented
+			}
+			http.Error(w, fmt.Sprintf("error purging the cache: %v", err), status)
+			return
+		}
+		result = &purgeResult{purged}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "the cache API only accepts GET, POST and DELETE requests", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("error encoding the cache response to json: %v", err)
+	}
+}
+
+//purge removes the cached summary of `pageURL`, if it isn't empty,
+//or else those of the pages on the hosts matching `host`, and returns
+//the number removed.
+func purge(r *http.Request, pageURL string, host string) (int, error) {
+	if len(pageURL) == 0 {
+		return Fetcher.PurgeHost(r.Context(), host)
+	}
+	entry, err := Fetcher.Cache.Get(r.Context(), pageURL)
+	if err != nil || entry == nil {
+		return 0, err
+	}
+	if err := Fetcher.Cache.Delete(r.Context(), pageURL); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+//CacheStatsHandler handles admin requests for the summary cache's
+//statistics. It responds with a JSON-encoded summary.CacheStats.
+func CacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "the cache stats API only accepts GET requests", http.StatusMethodNotAllowed)
+		return
+	}
+	if Fetcher.Cache == nil {
+		http.Error(w, "the summary cache is disabled", http.StatusNotFound)
+		return
+	}
+
+	stats, err := Fetcher.CacheStats(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading the cache: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Printf("error encoding the cache stats to json: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"Assignment1Summary/summary"
+)
+
+func TestBreakersHandler(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+	Fetcher.BreakerThreshold = 1
+	defer func() { Fetcher.BreakerThreshold = 0 }()
+	if _, err := Fetcher.Fetch(context.Background(), upstream.URL); err == nil {
+		t.Fatalf("expected the upstream request to fail")
+	}
+
+	cases := []struct {
+		name           string
+		hint           string
+		adminToken     string
+		authorization  string
+		expectedStatus int
+	}{
+		{
+			"Disabled",
+			"the admin API should be disabled when there is no admin token",
+			"",
+			"",
+			http.StatusNotFound,
+		},
+		{
+			"No Token",
+			"requests without the admin token should be unauthorized",
+			"secret",
+			"",
+			http.StatusUnauthorized,
+		},
+		{
+			"Wrong Token",
+			"requests with the wrong token should be unauthorized",
+			"secret",
+			"Bearer wrong",
+			http.StatusUnauthorized,
+		},
+		{
+			"Authorized",
+			"requests with the admin token should get the breakers",
+			"secret",
+			"Bearer secret",
+			http.StatusOK,
+		},
+	}
+
+	defer func() { AdminToken = "" }()
+	for _, c := range cases {
+		AdminToken = c.adminToken
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/admin/breakers", nil)
+		if len(c.authorization) > 0 {
+			req.Header.Set("Authorization", c.authorization)
+		}
+		BreakersHandler(resp, req)
+		if resp.Code != c.expectedStatus {
+			t.Errorf("case %s: expected status %d but got %d\nHINT: %s", c.name, c.expectedStatus, resp.Code, c.hint)
+			continue
+		}
+		if resp.Code != http.StatusOK {
+			continue
+		}
+		var breakers []*summary.BreakerState
+		if err := json.Unmarshal(resp.Body.Bytes(), &breakers); err != nil {
+			t.Errorf("case %s: error decoding response: %v\nHINT: %s", c.name, err, c.hint)
+			continue
+		}
+		u, _ := url.Parse(upstream.URL)
+		if len(breakers) != 1 || breakers[0].Host != u.Host || breakers[0].State != summary.BreakerOpen {
+			t.Errorf("case %s: expected the upstream's breaker to be open, but got %+v\nHINT: %s", c.name, breakers, c.hint)
+		}
+	}
+}
+
+func TestCacheHandler(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Fresh</title></head></html>`))
+	}))
+	defer upstream.Close()
+
+	ctx := context.Background()
+	cache := summary.NewMemoryCache(10)
+	Fetcher.Cache = cache
+	AdminToken = "secret"
+	defer func() {
+		Fetcher.Cache = nil
+		AdminToken = ""
+	}()
+	pageURL := upstream.URL + "/page"
+	otherURL := "https://other.example.com/page"
+
+	cases := []struct {
+		name           string
+		hint           string
+		method         string
+		query          string
+		expectedStatus int
+		expectedBody   string
+		expectedTitle  string
+	}{
+		{
+			"Look Up",
+			"GET should return the cached entry",
+			"GET",
+			"url=" + url.QueryEscape(pageURL),
+			http.StatusOK,
+			`"title":"Bad"`,
+			"Bad",
+		},
+		{
+			"Look Up Missing",
+			"GET should respond with 404 for a URL that isn't cached",
+			"GET",
+			"url=" + url.QueryEscape(upstream.URL+"/missing"),
+			http.StatusNotFound,
+			"",
+			"Bad",
+		},
+		{
+			"No URL",
+			"requests other than DELETE by host need a url",
+			"GET",
+			"host=example.com",
+			http.StatusBadRequest,
+			"",
+			"Bad",
+		},
+		{
+			"Refresh",
+			"POST should summarize the page again and cache it, even though the cached summary is fresh",
+			"POST",
+			"url=" + url.QueryEscape(pageURL),
+			http.StatusOK,
+			`"title":"Fresh"`,
+			"Fresh",
+		},
+		{
+			"Purge URL",
+			"DELETE should purge the URL's summary",
+			"DELETE",
+			"url=" + url.QueryEscape(pageURL),
+			http.StatusOK,
+			`{"purged":1}`,
+			"",
+		},
+		{
+			"Invalid Host Pattern",
+			"invalid host patterns should be rejected",
+			"DELETE",
+			"host=" + url.QueryEscape("[example.com"),
+			http.StatusBadRequest,
+			"",
+			"Bad",
+		},
+		{
+			"Purge Host",
+			"DELETE with a host pattern should purge the summaries of the matching hosts",
+			"DELETE",
+			"host=" + url.QueryEscape("*.example.com"),
+			http.StatusOK,
+			`{"purged":1}`,
+			"Bad",
+		},
+	}
+
+	for _, c := range cases {
+		//start each case with a bad summary of each page
+		for _, key := range []string{pageURL, otherURL} {
+			cache.Set(ctx, key, &summary.CacheEntry{Summary: &summary.PageSummary{Title: "Bad"}, Stored: time.Now()})
+		}
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest(c.method, "/v1/admin/cache?"+c.query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		CacheHandler(resp, req)
+		if resp.Code != c.expectedStatus {
+			t.Errorf("case %s: expected status %d but got %d: %s\nHINT: %s", c.name, c.expectedStatus, resp.Code, resp.Body.String(), c.hint)
+			continue
+		}
+		if !strings.Contains(resp.Body.String(), c.expectedBody) {
+			t.Errorf("case %s: expected the response to contain %s but got %s\nHINT: %s", c.name, c.expectedBody, resp.Body.String(), c.hint)
+		}
+		var title string
+		if entry, _ := cache.Get(ctx, pageURL); entry != nil {
+			title = entry.Summary.Title
+		}
+		if title != c.expectedTitle {
+			t.Errorf("case %s: expected the cached title to be %q but got %q\nHINT: %s", c.name, c.expectedTitle, title, c.hint)
+		}
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/admin/cache/stats", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	CacheStatsHandler(resp, req)
+	//the last case purged the other host's summary
+	stats := &summary.CacheStats{}
+	if err := json.Unmarshal(resp.Body.Bytes(), stats); resp.Code != http.StatusOK || err != nil || stats.Entries != 1 {
+		t.Errorf("expected stats with 1 entry, but got status %d: %s", resp.Code, resp.Body.String())
+	}
+}
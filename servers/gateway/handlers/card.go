@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+
+	"Assignment1Summary/summary"
+)
+
+//cardTemplate is a color scheme and layout for a generated card image.
+type cardTemplate struct {
+	Background color.RGBA
+	Text       color.RGBA
+	Muted      color.RGBA
+	Accent     color.RGBA
+	//Centered centers the title and description
+	//instead of aligning them to the left.
+	Centered bool
+}
+
+//cardTemplates are the templates a client may request by name.
+var cardTemplates = map[string]*cardTemplate{
+	"light": {
+		Background: color.RGBA{0xff, 0xff, 0xff, 0xff},
+		Text:       color.RGBA{0x1a, 0x1a, 0x1a, 0xff},
+		Muted:      color.RGBA{0x5f, 0x63, 0x68, 0xff},
+		Accent:     color.RGBA{0x1a, 0x73, 0xe8, 0xff},
+	},
+	"dark": {
+		Background: color.RGBA{0x20, 0x21, 0x24, 0xff},
+		Text:       color.RGBA{0xf1, 0xf3, 0xf4, 0xff},
+		Muted:      color.RGBA{0xbd, 0xc1, 0xc6, 0xff},
+		Accent:     color.RGBA{0x8a, 0xb4, 0xf8, 0xff},
+		Centered:   true,
+	},
+}
+
+//cardSizes are the image sizes a client may request by name.
+var cardSizes = map[string]image.Point{
+	"landscape": {1200, 630},
+	"square":    {1200, 1200},
+}
+
+//Layout of card images, in pixels.
+const (
+	cardPadding     = 72
+	cardAccentWidth = 16
+	cardIconSize    = 64
+	cardSiteSize    = 32
+	cardTitleSize   = 64
+	cardDescSize    = 34
+	cardTitleLines  = 3
+)
+
+//cardFonts are the bundled Go fonts, parsed once on first use.
+var cardFonts struct {
+	once    sync.Once
+	regular *opentype.Font
+	bold    *opentype.Font
+	err     error
+}
+
+//loadCardFonts parses the bundled fonts.
+func loadCardFonts() error {
+	cardFonts.once.Do(func() {
+		cardFonts.regular, cardFonts.err = opentype.Parse(goregular.TTF)
+		if cardFonts.err == nil {
+			cardFonts.bold, cardFonts.err = opentype.Parse(gobold.TTF)
+		}
+	})
+	return cardFonts.err
+}
+
+//CardHandler handles requests for the card image API.
+//This API expects a query string parameter named `url`, which should
+//contain a URL to a web page. It responds with a PNG card image showing
+//the page's title, site name, icon and description, which clients can
+//show when the page has no preview image of its own. The optional
+//`template` parameter may be "light" (the default) or "dark", and the
+//optional `size` parameter may be "landscape" (1200x630, the default)
+//or "square" (1200x1200).
+func CardHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	pageURL := r.URL.Query().Get("url")
+	if len(pageURL) == 0 {
+		http.Error(w, "No url query string parameter found in the request", http.StatusBadRequest)
+		return
+	}
+	templateName := r.URL.Query().Get("template")
+	if len(templateName) == 0 {
+		templateName = "light"
+	}
+	tmpl, found := cardTemplates[templateName]
+	if !found {
+		http.Error(w, fmt.Sprintf("unknown card template %q", templateName), http.StatusBadRequest)
+		return
+	}
+	sizeName := r.URL.Query().Get("size")
+	if len(sizeName) == 0 {
+		sizeName = "landscape"
+	}
+	size, found := cardSizes[sizeName]
+	if !found {
+		http.Error(w, fmt.Sprintf("unknown card size %q", sizeName), http.StatusBadRequest)
+		return
+	}
+
+	pageSummary, err := Fetcher.Summarize(r.Context(), pageURL)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error summarizing URL: %v", err), http.StatusBadRequest)
+		return
+	}
+	var icon image.Image
+	if pageSummary.Icon != nil {
+		//pages often have icons we can't decode, such as .ico files,
+		//so the card is still rendered without one
+		scaled, err := fetchScaledImage(r.Context(), pageSummary.Icon.URL, cardIconSize, image.Transparent)
+		if err == nil {
+			icon = scaled
+		}
+	}
+
+	card, err := renderCard(pageSummary, pageURL, icon, tmpl, size)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error rendering card: %v", err), http.StatusInternalServerError)
+		return
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, card); err != nil {
+		http.Error(w, fmt.Sprintf("error encoding card: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeImage(w, buf.Bytes(), "image/png")
+}
+
+//renderCard draws a card image of the given size for `pageSummary` using
+//`tmpl`. The icon may be nil, and if the summary has no site name,
+//the host name of `pageURL` is shown instead.
+func renderCard(pageSummary *summary.PageSummary, pageURL string, icon image.Image, tmpl *cardTemplate, size image.Point) (*image.RGBA, error) {
+	if err := loadCardFonts(); err != nil {
+		return nil, err
+	}
+	siteFace, err := newCardFace(cardFonts.regular, cardSiteSize)
+	if err != nil {
+		return nil, err
+	}
+	defer siteFace.Close()
+	titleFace, err := newCardFace(cardFonts.bold, cardTitleSize)
+	if err != nil {
+		return nil, err
+	}
+	defer titleFace.Close()
+	descFace, err := newCardFace(cardFonts.regular, cardDescSize)
+	if err != nil {
+		return nil, err
+	}
+	defer descFace.Close()
+
+	card := image.NewRGBA(image.Rectangle{Max: size})
+	background := image.NewUniform(tmpl.Background)
+	draw.Draw(card, card.Bounds(), background, image.Point{}, draw.Src)
+	if !tmpl.Centered {
+		draw.Draw(card, image.Rect(0, 0, cardAccentWidth, size.Y), image.NewUniform(tmpl.Accent), image.Point{}, draw.Src)
+	}
+
+	left := cardPadding
+	width := size.X - 2*cardPadding
+	y := cardPadding
+
+	//header: icon and site name
+	siteName := pageSummary.SiteName
+	if len(siteName) == 0 {
+		if u, err := url.Parse(pageURL); err == nil {
+			siteName = strings.TrimPrefix(u.Hostname(), "www.")
+		}
+	}
+	textLeft := left
+	if icon != nil {
+		//icons are never scaled up, so center smaller ones in their box
+		scaled := scaleImage(icon, cardIconSize, background)
+		offset := image.Pt(left+(cardIconSize-scaled.Bounds().Dx())/2, y+(cardIconSize-scaled.Bounds().Dy())/2)
+		iconRect := scaled.Bounds().Add(offset)
+		draw.Draw(card, iconRect, scaled, image.Point{}, draw.Over)
+		textLeft += cardIconSize + cardPadding/3
+	}
+	siteLines := wrapText(siteFace, siteName, left+width-textLeft, 1)
+	if len(siteLines) > 0 {
+		baseline := y + (cardIconSize+siteFace.Metrics().Ascent.Ceil()-siteFace.Metrics().Descent.Ceil())/2
+		drawText(card, siteFace, tmpl.Muted, siteLines[0], textLeft, baseline)
+	}
+	y += cardIconSize + cardPadding*2/3
+
+	//title, then as much of the description as fits
+	title := pageSummary.Title
+	if len(title) == 0 {
+		title = pageURL
+	}
+	y = drawParagraph(card, titleFace, tmpl, wrapText(titleFace, title, width, cardTitleLines), left, width, y)
+	if tmpl.Centered {
+		y += cardPadding / 3
+		accentLeft := (size.X - cardPadding*2) / 2
+		draw.Draw(card, image.Rect(accentLeft, y, accentLeft+cardPadding*2, y+cardAccentWidth/2), image.NewUniform(tmpl.Accent), image.Point{}, draw.Src)
+		y += cardAccentWidth / 2
+	}
+	y += cardPadding / 3
+
+	descHeight := descFace.Metrics().Height.Ceil()
+	descLines := (size.Y - cardPadding - y) / descHeight
+	if descLines > 0 && len(pageSummary.Description) > 0 {
+		muted := *tmpl
+		muted.Text = tmpl.Muted
+		drawParagraph(card, descFace, &muted, wrapText(descFace, pageSummary.Description, width, descLines), left, width, y)
+	}
+	return card, nil
+}
+
+//newCardFace returns a face for `f` at `size` pixels.
+func newCardFace(f *opentype.Font, size float64) (font.Face, error) {
+	return opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
+
+//drawParagraph draws `lines` starting at the top `y`, aligned within
+//`left` and `width` as `tmpl` says, and returns the y of their bottom.
+func drawParagraph(dst draw.Image, face font.Face, tmpl *cardTemplate, lines []string, left int, width int, y int) int {
+	metrics := face.Metrics()
+	for _, line := range lines {
+		x := left
+		if tmpl.Centered {
+			x += (width - font.MeasureString(face, line).Ceil()) / 2
+		}
+		drawText(dst, face, tmpl.Text, line, x, y+metrics.Ascent.Ceil())
+		y += metrics.Height.Ceil()
+	}
+	return y
+}
+
+//drawText draws `text` with its baseline starting at `x`, `y`.
+func drawText(dst draw.Image, face font.Face, c color.Color, text string, x int, y int) {
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+//wrapText breaks `text` into at most `maxLines` lines no wider than
+//`width`. If the text doesn't fit, the last line ends with an ellipsis.
+func wrapText(face font.Face, text string, width int, maxLines int) []string {
+	maxWidth := fixed.I(width)
+	fits := func(s string) bool {
+		return font.MeasureString(face, s) <= maxWidth
+	}
+
+	var lines []string
+	line := ""
+	words := strings.Fields(text)
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		candidate := word
+		if len(line) > 0 {
+			candidate = line + " " + word
+		}
+		if fits(candidate) {
+			line = candidate
+			continue
+		}
+		if len(line) == 0 {
+			//a single word wider than the line is broken where it overflows
+			runes := []rune(word)
+			n := 1
+			for n < len(runes) && fits(string(runes[:n+1])) {
+				n++
+			}
+			line = string(runes[:n])
+			words[i] = string(runes[n:])
+			i--
+		} else {
+			i--
+		}
+		lines = append(lines, line)
+		line = ""
+		if len(lines) == maxLines {
+			return ellipsize(lines, fits)
+		}
+	}
+	if len(line) > 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+//ellipsize shortens the last of `lines` so that it
+//still fits with an ellipsis added to the end.
+func ellipsize(lines []string, fits func(string) bool) []string {
+	last := []rune(lines[len(lines)-1])
+	for len(last) > 0 && !fits(string(last)+"…") {
+		last = last[:len(last)-1]
+	}
+	lines[len(lines)-1] = strings.TrimRight(string(last), " ") + "…"
+	return lines
+}
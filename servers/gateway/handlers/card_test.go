@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"Assignment1Summary/internal/testimage"
+)
+
+func TestWrapText(t *testing.T) {
+	if err := loadCardFonts(); err != nil {
+		t.Fatalf("error loading fonts: %v", err)
+	}
+	face, err := newCardFace(cardFonts.regular, 20)
+	if err != nil {
+		t.Fatalf("error creating face: %v", err)
+	}
+	defer face.Close()
+
+	cases := []struct {
+		name     string
+		text     string
+		width    int
+		maxLines int
+		expected []string
+	}{
+		{"Fits", "short title", 1000, 3, []string{"short title"}},
+		{"Wraps", "one two three four", 90, 3, []string{"one two", "three four"}},
+		{"Ellipsis", "one two three four five six seven", 90, 2, []string{"one two", "three fo…"}},
+		{"Long Word", "abcdefghijklmnopqrstuvwxyz", 100, 5, nil},
+		{"Empty", "", 100, 3, nil},
+	}
+	for _, c := range cases {
+		lines := wrapText(face, c.text, c.width, c.maxLines)
+		if c.name == "Long Word" {
+			if len(lines) < 2 || strings.Join(lines, "") != c.text {
+				t.Errorf("case %s: expected the word to be broken across lines but got %q", c.name, lines)
+			}
+			continue
+		}
+		if strings.Join(lines, "|") != strings.Join(c.expected, "|") {
+			t.Errorf("case %s: expected %q but got %q", c.name, c.expected, lines)
+		}
+	}
+}
+
+func TestCardHandler(t *testing.T) {
+	icon := testimage.Encode(t, "png", 16, 16)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/icon.png" {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(icon)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head>
+			<title>A page with a rather long title that will need to wrap onto more than one line</title>
+			<meta name="description" content="And a description to go with it.">
+			<link rel="icon" href="/icon.png">
+			</head></html>`))
+	}))
+	defer upstream.Close()
+
+	cases := []struct {
+		query          string
+		expectedStatus int
+		expectedSize   image.Point
+	}{
+		{"", http.StatusOK, image.Pt(1200, 630)},
+		{"&template=dark&size=square", http.StatusOK, image.Pt(1200, 1200)},
+		{"&template=neon", http.StatusBadRequest, image.Point{}},
+		{"&size=huge", http.StatusBadRequest, image.Point{}},
+	}
+	for _, c := range cases {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/card?url="+url.QueryEscape(upstream.URL+"/page.html")+c.query, nil)
+		CardHandler(resp, req)
+		if resp.Code != c.expectedStatus {
+			t.Errorf("query %q: expected status code %d but got %d: %s", c.query, c.expectedStatus, resp.Code, resp.Body.String())
+			continue
+		}
+		if resp.Code != http.StatusOK {
+			continue
+		}
+		if ctype := resp.Header().Get("Content-Type"); ctype != "image/png" {
+			t.Errorf("query %q: expected Content-Type image/png but got %s", c.query, ctype)
+		}
+		img, err := png.Decode(resp.Body)
+		if err != nil {
+			t.Errorf("query %q: error decoding card: %v", c.query, err)
+			continue
+		}
+		if img.Bounds().Size() != c.expectedSize {
+			t.Errorf("query %q: expected a %v card but got %v", c.query, c.expectedSize, img.Bounds().Size())
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"unicode/utf8"
+
+	"Assignment1Summary/summary"
+)
+
+//Limits on ad-hoc extraction requests, so that a single request
+//can't make the gateway do an unbounded amount of matching.
+const (
+	//maxExtractRequestBytes limits the size of the request body.
+	maxExtractRequestBytes = 64 << 10
+	//maxExtractSelectors limits how many selectors a request may have.
+	maxExtractSelectors = 20
+	//maxSelectorLength limits the length of each selector.
+	maxSelectorLength = 256
+	//maxSelectorComplexity limits the number of simple selectors
+	//and combinators in each selector.
+	maxSelectorComplexity = 16
+	//maxExtractValues limits how many values each selector returns.
+	maxExtractValues = 20
+	//maxExtractValueLength limits the length of each value in bytes.
+	maxExtractValueLength = 1024
+)
+
+//extractRequest is the body of a request to the extraction API.
+type extractRequest struct {
+	URL       string                        `json:"url"`
+	Selectors map[string]*summary.FieldRule `json:"selectors"`
+}
+
+//ExtractHandler handles requests for the ad-hoc extraction API.
+//This API expects a POST request with a JSON body like:
+//
+//  {
+//    "url": "https://example.com/product",
+//    "selectors": {
+//      "price": "span.price",
+//      "version": {"selector": "meta[name=version]", "attr": "content"}
+//    }
+//  }
+//
+//Each selector is a CSS selector, whose matching elements' text is
+//returned, or an object with a selector and the attribute to read.
+//It responds with the page's JSON-encoded summary.PageSummary, whose
+//`values` object has the values each selector found.
+func ExtractHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "the extraction API only accepts POST requests", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req := &extractRequest{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxExtractRequestBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		http.Error(w, fmt.Sprintf("error decoding request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.URL) == 0 {
+		http.Error(w, "No url found in the request", http.StatusBadRequest)
+		return
+	}
+	if err := checkSelectors(req.Selectors); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := Fetcher.Options()
+	opts.Queries = req.Selectors
+	pageSummary, err := Fetcher.SummarizeWith(r.Context(), req.URL, opts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error summarizing URL: %v", err), http.StatusBadRequest)
+		return
+	}
+	limitValues(pageSummary.Values)
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(pageSummary); err != nil {
+		log.Printf("error encoding the summary to json: %v", err)
+	}
+}
+
+//checkSelectors returns an error if there are no selectors,
+//or if they exceed the limits on their number and complexity.
+func checkSelectors(selectors map[string]*summary.FieldRule) error {
+	if len(selectors) == 0 {
+		return fmt.Errorf("no selectors found in the request")
+	}
+	if len(selectors) > maxExtractSelectors {
+		return fmt.Errorf("too many selectors: the limit is %d", maxExtractSelectors)
+	}
+	for name, rule := range selectors {
+		if rule == nil {
+			return fmt.Errorf("selector %q is null", name)
+		}
+		if len(rule.Selector) > maxSelectorLength {
+			return fmt.Errorf("selector %q is too long: the limit is %d characters", name, maxSelectorLength)
+		}
+		if rule.Complexity() > maxSelectorComplexity {
+			return fmt.Errorf("selector %q is too complex: the limit is %d simple selectors and combinators", name, maxSelectorComplexity)
+		}
+	}
+	return nil
+}
+
+//limitValues truncates the values to the limits on their number and length.
+func limitValues(values summary.Values) {
+	for name, list := range values {
+		if len(list) > maxExtractValues {
+			list = list[:maxExtractValues]
+		}
+		for i, value := range list {
+			if len(value) > maxExtractValueLength {
+				//don't split a multi-byte character, by backing up to
+				//the start of the character the cut would fall in
+				cut := maxExtractValueLength
+				for back := 0; back < utf8.UTFMax && cut > 0 && !utf8.RuneStart(value[cut]); back++ {
+					cut--
+				}
+				list[i] = value[:cut]
+			}
+		}
+		values[name] = list
+	}
+}
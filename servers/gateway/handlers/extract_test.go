@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"Assignment1Summary/summary"
+)
+
+func TestExtractHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Product</title><meta name="version" content="1.2.3"></head><body>
+			<span class="price">$10</span><span class="price">$12</span>
+			<p class="long">` + strings.Repeat("é", 1000) + `</p>
+			</body></html>`))
+	}))
+	defer server.Close()
+
+	tooMany := map[string]string{}
+	for i := 0; i <= maxExtractSelectors; i++ {
+		tooMany[fmt.Sprintf("s%d", i)] = "p"
+	}
+	tooManyJSON, _ := json.Marshal(tooMany)
+
+	cases := []struct {
+		name           string
+		hint           string
+		method         string
+		body           string
+		expectedStatus int
+		expectedValues summary.Values
+	}{
+		{
+			"Text and Attribute Values",
+			"selectors should return element text, or an attribute if one is given",
+			"POST",
+			`{"url": "` + server.URL + `", "selectors": {
+				"price": "span.price",
+				"version": {"selector": "meta[name=version]", "attr": "content"},
+				"missing": "table"
+			}}`,
+			http.StatusOK,
+			summary.Values{
+				"price":   {"$10", "$12"},
+				"version": {"1.2.3"},
+			},
+		},
+		{
+			"Long Value",
+			"long values should be truncated without splitting characters",
+			"POST",
+			`{"url": "` + server.URL + `", "selectors": {"long": "p.long"}}`,
+			http.StatusOK,
+			summary.Values{
+				"long": {strings.Repeat("é", maxExtractValueLength/2)},
+			},
+		},
+		{
+			"GET",
+			"only POST requests should be accepted",
+			"GET",
+			"",
+			http.StatusMethodNotAllowed,
+			nil,
+		},
+		{
+			"No URL",
+			"a URL is required",
+			"POST",
+			`{"selectors": {"price": "span.price"}}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"No Selectors",
+			"at least one selector is required",
+			"POST",
+			`{"url": "` + server.URL + `"}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"Invalid Selector",
+			"invalid selectors should be rejected",
+			"POST",
+			`{"url": "` + server.URL + `", "selectors": {"price": "span["}}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"Too Many Selectors",
+			"the number of selectors should be limited",
+			"POST",
+			`{"url": "` + server.URL + `", "selectors": ` + string(tooManyJSON) + `}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"Too Complex Selector",
+			"the complexity of each selector should be limited",
+			"POST",
+			`{"url": "` + server.URL + `", "selectors": {"deep": "` + strings.Repeat("div ", maxSelectorComplexity) + `p"}}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"Unknown Field",
+			"unknown request fields should be rejected",
+			"POST",
+			`{"url": "` + server.URL + `", "selectors": {"price": "span.price"}, "selector": "p"}`,
+			http.StatusBadRequest,
+			nil,
+		},
+	}
+
+	for _, c := range cases {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(c.method, "/v1/extract", strings.NewReader(c.body))
+		ExtractHandler(resp, req)
+		if resp.Code != c.expectedStatus {
+			t.Errorf("case %s: expected status code %d but got %d: %s\nHINT: %s",
+				c.name, c.expectedStatus, resp.Code, resp.Body.String(), c.hint)
+			continue
+		}
+		if resp.Code != http.StatusOK {
+			continue
+		}
+		pageSummary := &summary.PageSummary{}
+		if err := json.NewDecoder(resp.Body).Decode(pageSummary); err != nil {
+			t.Errorf("case %s: error decoding response: %v", c.name, err)
+			continue
+		}
+		if pageSummary.Title != "Product" {
+			t.Errorf("case %s: expected the normal summary with title %q but got %q", c.name, "Product", pageSummary.Title)
+		}
+		if !reflect.DeepEqual(pageSummary.Values, c.expectedValues) {
+			t.Errorf("case %s: expected values %v but got %v\nHINT: %s", c.name, c.expectedValues, pageSummary.Values, c.hint)
+		}
+	}
+}
+
+func TestLimitValues(t *testing.T) {
+	cases := []struct {
+		name     string
+		hint     string
+		value    string
+		expected string
+	}{
+		{
+			"Short",
+			"values within the limit should be kept",
+			"short",
+			"short",
+		},
+		{
+			"Split Character",
+			"the cut should back up to the start of the character it falls in",
+			"a" + strings.Repeat("é", maxExtractValueLength/2),
+			"a" + strings.Repeat("é", maxExtractValueLength/2-1),
+		},
+		{
+			"Invalid UTF-8",
+			"invalid UTF-8 before the cut shouldn't empty the value",
+			"\xff" + strings.Repeat("a", maxExtractValueLength),
+			"\xff" + strings.Repeat("a", maxExtractValueLength-1),
+		},
+	}
+
+	for _, c := range cases {
+		values := summary.Values{"value": {c.value}}
+		limitValues(values)
+		if actual := values["value"][0]; actual != c.expected {
+			t.Errorf("case %s: expected a value of %d bytes but got %d\nHINT: %s", c.name, len(c.expected), len(actual), c.hint)
+		}
+	}
+}
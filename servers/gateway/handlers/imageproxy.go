@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"Assignment1Summary/summary"
+)
+
+//ImageProxySecret is the key used to sign proxied image URLs.
+//main sets this from the IMAGE_PROXY_SECRET environment variable.
+//If it is empty, the image proxy API is disabled, so that it can't be
+//used as an open proxy, and SummaryHandler can't return proxied URLs.
+var ImageProxySecret []byte
+
+//MaxImageBytes is the largest image ImageHandler will proxy.
+var MaxImageBytes int64 = 10 << 20
+
+//imageCacheMaxAge is how long, in seconds, clients
+//and shared caches may cache a proxied image.
+const imageCacheMaxAge = 24 * 60 * 60
+
+//ImageHandler handles requests for the image proxy API.
+//This API expects a query string parameter named `url`,
+//which should contain the URL of an image, and a `sig` parameter with
+//that URL's signature. It fetches the image with Fetcher, verifies that
+//it is an image, and sends it back with caching headers.
+//If the optional `w` and/or `h` parameters are supplied, it instead
+//responds with a thumbnail no larger than that width and height.
+//The optional `fit` parameter may be "contain" (the default) to fit
+//the whole image within that size, or "cover" to crop it to that size.
+func ImageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	if len(ImageProxySecret) == 0 {
+		http.Error(w, "the image proxy API is disabled", http.StatusNotFound)
+		return
+	}
+	imgURL := r.URL.Query().Get("url")
+	if len(imgURL) == 0 {
+		http.Error(w, "No url query string parameter found in the request", http.StatusBadRequest)
+		return
+	}
+	if !validImageSignature(imgURL, r.URL.Query().Get("sig")) {
+		http.Error(w, "invalid or missing image URL signature", http.StatusForbidden)
+		return
+	}
+	opts, err := parseThumbnailOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts != nil {
+		if thumb, mediaType := cachedThumbnail(imgURL, opts); thumb != nil {
+			writeImage(w, thumb, mediaType)
+			return
+		}
+	}
+
+	page, err := Fetcher.Fetch(r.Context(), imgURL)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error fetching image: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer page.Body.Close()
+
+	mediaType := page.MediaType()
+	if !strings.HasPrefix(mediaType, "image/") {
+		http.Error(w, fmt.Sprintf("%s is not an image", imgURL), http.StatusBadGateway)
+		return
+	}
+	if page.ContentLength > MaxImageBytes {
+		http.Error(w, fmt.Sprintf("image is larger than %d bytes", MaxImageBytes), http.StatusBadGateway)
+		return
+	}
+
+	//read one byte past the limit, so that an image without a
+	//Content-Length that is too large is rejected rather than truncated
+	data, err := io.ReadAll(io.LimitReader(page.Body, MaxImageBytes+1))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error fetching image: %v", err), http.StatusBadGateway)
+		return
+	}
+	if int64(len(data)) > MaxImageBytes {
+		http.Error(w, fmt.Sprintf("image is larger than %d bytes", MaxImageBytes), http.StatusBadGateway)
+		return
+	}
+
+	if opts != nil {
+		thumb, thumbType, err := makeThumbnail(r.Context(), data, opts)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error resizing image: %v", err), http.StatusBadGateway)
+			return
+		}
+		if err := cacheThumbnail(imgURL, opts, thumb, thumbType); err != nil {
+			log.Printf("error caching thumbnail of %s: %v", imgURL, err)
+		}
+		writeImage(w, thumb, thumbType)
+		return
+	}
+
+	for _, name := range []string{"ETag", "Last-Modified"} {
+		if v := page.Header.Get(name); len(v) > 0 {
+			w.Header().Set(name, v)
+		}
+	}
+	writeImage(w, data, mediaType)
+}
+
+//setImageHeaders sets the content type and caching
+//and security headers of an image response.
+func setImageHeaders(w http.ResponseWriter, mediaType string) {
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", imageCacheMaxAge))
+	//SVG images can contain scripts, so never let them run
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+}
+
+//writeImage responds with an image that is already in memory.
+func writeImage(w http.ResponseWriter, data []byte, mediaType string) {
+	setImageHeaders(w, mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if _, err := w.Write(data); err != nil {
+		log.Printf("error writing image: %v", err)
+	}
+}
+
+//signImageURL returns the hex-encoded HMAC-SHA256 of `imgURL`.
+func signImageURL(imgURL string) string {
+	mac := hmac.New(sha256.New, ImageProxySecret)
+	mac.Write([]byte(imgURL))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//validImageSignature reports whether `sig` is the signature of `imgURL`.
+func validImageSignature(imgURL string, sig string) bool {
+	return hmac.Equal([]byte(signImageURL(imgURL)), []byte(strings.ToLower(sig)))
+}
+
+//proxiedImageURL returns the signed URL of `imgURL` on the image
+//proxy API at `base`, which is the scheme and host of this server.
+func proxiedImageURL(base string, imgURL string) string {
+	if len(imgURL) == 0 {
+		return ""
+	}
+	query := url.Values{}
+	query.Set("url", imgURL)
+	query.Set("sig", signImageURL(imgURL))
+	return base + "/v1/image?" + query.Encode()
+}
+
+//proxyImageURLs replaces the icon and image URLs in `pageSummary`
+//with signed URLs on the image proxy API at `base`.
+func proxyImageURLs(pageSummary *summary.PageSummary, base string) {
+	images := pageSummary.Images
+	if pageSummary.Icon != nil {
+		images = append([]*summary.PreviewImage{pageSummary.Icon}, images...)
+	}
+	for _, img := range images {
+		//the proxy always serves over our own scheme, so it can fetch
+		//the secure URL if there is one and drop the separate field
+		if len(img.SecureURL) > 0 {
+			img.URL = img.SecureURL
+			img.SecureURL = ""
+		}
+		img.URL = proxiedImageURL(base, img.URL)
+	}
+}
+
+//requestBaseURL returns the scheme and host `r` was sent to.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"Assignment1Summary/internal/testimage"
+	"Assignment1Summary/summary"
+)
+
+func TestImageHandler(t *testing.T) {
+	png := testimage.Encode(t, "png", 20, 10)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.png":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("ETag", `"abc"`)
+			w.Write(png)
+		case "/large.png":
+			//flush before writing the body, so there is no Content-Length
+			w.Header().Set("Content-Type", "image/png")
+			w.(http.Flusher).Flush()
+			w.Write(png)
+			w.Write(png)
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	ImageProxySecret = []byte("test secret")
+	defer func() { ImageProxySecret = nil }()
+	defer func(max int64) { MaxImageBytes = max }(MaxImageBytes)
+	MaxImageBytes = int64(len(png))
+
+	cases := []struct {
+		name           string
+		hint           string
+		imgURL         string
+		sig            string
+		expectedStatus int
+	}{
+		{
+			"Signed Image",
+			"A signed image URL should be proxied",
+			upstream.URL + "/image.png",
+			signImageURL(upstream.URL + "/image.png"),
+			http.StatusOK,
+		},
+		{
+			"Missing Signature",
+			"Image URLs must be signed when ImageProxySecret is set",
+			upstream.URL + "/image.png",
+			"",
+			http.StatusForbidden,
+		},
+		{
+			"Wrong Signature",
+			"Signatures for a different URL should be rejected",
+			upstream.URL + "/image.png",
+			signImageURL(upstream.URL + "/other.png"),
+			http.StatusForbidden,
+		},
+		{
+			"Not an Image",
+			"Only images should be proxied",
+			upstream.URL + "/page.html",
+			signImageURL(upstream.URL + "/page.html"),
+			http.StatusBadGateway,
+		},
+		{
+			"Too Large",
+			"Images without a Content-Length that are larger than MaxImageBytes should be rejected, not truncated",
+			upstream.URL + "/large.png",
+			signImageURL(upstream.URL + "/large.png"),
+			http.StatusBadGateway,
+		},
+		{
+			"Not Found",
+			"Upstream errors should be reported",
+			upstream.URL + "/missing.png",
+			signImageURL(upstream.URL + "/missing.png"),
+			http.StatusBadGateway,
+		},
+	}
+
+	for _, c := range cases {
+		query := url.Values{"url": {c.imgURL}, "sig": {c.sig}}
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/image?"+query.Encode(), nil)
+		ImageHandler(resp, req)
+		if resp.Code != c.expectedStatus {
+			t.Errorf("case %s: expected status code %d but got %d\nHINT: %s", c.name, c.expectedStatus, resp.Code, c.hint)
+			continue
+		}
+		if resp.Code != http.StatusOK {
+			continue
+		}
+		if ctype := resp.Header().Get("Content-Type"); ctype != "image/png" {
+			t.Errorf("case %s: expected Content-Type image/png but got %s", c.name, ctype)
+		}
+		if cc := resp.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "public") {
+			t.Errorf("case %s: expected a public Cache-Control header but got %q", c.name, cc)
+		}
+		if etag := resp.Header().Get("ETag"); etag != `"abc"` {
+			t.Errorf("case %s: expected the upstream ETag but got %q", c.name, etag)
+		}
+		if resp.Body.Len() != len(png) {
+			t.Errorf("case %s: expected %d bytes of image but got %d", c.name, len(png), resp.Body.Len())
+		}
+	}
+
+	//without a secret, the image proxy would be an open proxy
+	ImageProxySecret = nil
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/image?url="+url.QueryEscape(upstream.URL+"/image.png"), nil)
+	ImageHandler(resp, req)
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d without a secret but got %d\nHINT: the image proxy API should be disabled when ImageProxySecret isn't set", http.StatusNotFound, resp.Code)
+	}
+}
+
+func TestProxyImageURLs(t *testing.T) {
+	ImageProxySecret = []byte("test secret")
+	defer func() { ImageProxySecret = nil }()
+
+	pageSummary := &summary.PageSummary{
+		Icon: &summary.PreviewImage{URL: "http://test.com/icon.png"},
+		Images: []*summary.PreviewImage{
+			{URL: "http://test.com/a.png", SecureURL: "https://test.com/a.png"},
+		},
+	}
+	proxyImageURLs(pageSummary, "https://gateway.test")
+
+	for _, img := range []*summary.PreviewImage{pageSummary.Icon, pageSummary.Images[0]} {
+		u, err := url.Parse(img.URL)
+		if err != nil || u.Host != "gateway.test" || u.Path != "/v1/image" {
+			t.Errorf("expected a URL on the image proxy API but got %q", img.URL)
+			continue
+		}
+		if !validImageSignature(u.Query().Get("url"), u.Query().Get("sig")) {
+			t.Errorf("proxied URL %q has an invalid signature", img.URL)
+		}
+	}
+	if src := pageSummary.Images[0].URL; !strings.Contains(src, url.QueryEscape("https://test.com/a.png")) {
+		t.Errorf("expected the secure URL to be proxied but got %q", src)
+	}
+}
+
+func TestSummaryHandlerProxyDisabled(t *testing.T) {
+	fetched := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = true
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Page</title></head></html>`))
+	}))
+	defer upstream.Close()
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/summary?proxy=true&url="+url.QueryEscape(upstream.URL), nil)
+	SummaryHandler(resp, req)
+	if resp.Code != http.StatusBadRequest || fetched {
+		t.Errorf("expected status code %d without fetching the page but got %d\nHINT: proxied image URLs can't be returned when ImageProxySecret isn't set", http.StatusBadRequest, resp.Code)
+	}
+}
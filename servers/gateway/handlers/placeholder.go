@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+
+	"Assignment1Summary/summary"
+)
+
+//placeholderSize is the width and height we downscale images to
+//before computing their placeholders.
+const placeholderSize = 32
+
+//blurHashComponents is the number of BlurHash components
+//along the longer side of an image.
+const blurHashComponents = 4
+
+//blurHashCharacters are the digits of the base 83 encoding BlurHash uses.
+const blurHashCharacters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+//addImagePlaceholders fetches each image and sets its dominant color and
+//BlurHash, which clients can show while the image loads. Images that
+//can't be fetched or decoded are left as they are.
+func addImagePlaceholders(ctx context.Context, images []*summary.PreviewImage) {
+	if len(images) > maxProbedImages {
+		images = images[:maxProbedImages]
+	}
+	wg := sync.WaitGroup{}
+	for _, img := range images {
+		wg.Add(1)
+		go func(img *summary.PreviewImage) {
+			defer wg.Done()
+			imgURL := img.URL
+			if len(img.SecureURL) > 0 {
+				imgURL = img.SecureURL
+			}
+			small, err := fetchSmallImage(ctx, imgURL)
+			if err != nil {
+				return
+			}
+			img.Color = dominantColor(small)
+			img.BlurHash = blurHash(small)
+		}(img)
+	}
+	wg.Wait()
+}
+
+//fetchSmallImage fetches and decodes an image, and returns it downscaled
+//to fit within placeholderSize and composited over a white background.
+func fetchSmallImage(ctx context.Context, imgURL string) (*image.RGBA, error) {
+	return fetchScaledImage(ctx, imgURL, placeholderSize, image.White)
+}
+
+//fetchScaledImage fetches and decodes an image, and returns it downscaled
+//to fit within `size` by `size` and composited over `background`. Only
+//the scaled image is kept, so the decoded one can be freed right away.
+func fetchScaledImage(ctx context.Context, imgURL string, size int, background image.Image) (*image.RGBA, error) {
+	data, err := fetchImage(ctx, imgURL)
+	if err != nil {
+		return nil, err
+	}
+	var scaled *image.RGBA
+	err = withDecodedImage(ctx, data, func(src image.Image) error {
+		scaled = scaleImage(src, size, background)
+		return nil
+	})
+	return scaled, err
+}
+
+//fetchImage fetches an image and returns its undecoded bytes.
+func fetchImage(ctx context.Context, imgURL string) ([]byte, error) {
+	page, err := Fetcher.Fetch(ctx, imgURL)
+	if err != nil {
+		return nil, err
+	}
+	defer page.Body.Close()
+	if !strings.HasPrefix(page.MediaType(), "image/") {
+		return nil, fmt.Errorf("%s is not an image", imgURL)
+	}
+	return io.ReadAll(io.LimitReader(page.Body, MaxImageBytes))
+}
+
+//scaleImage returns `src` downscaled to fit within
+//`size` by `size` and composited over `background`.
+func scaleImage(src image.Image, size int, background image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	width, height, _ := thumbnailGeometry(bounds.Dx(), bounds.Dy(),
+		&thumbnailOptions{Width: size, Height: size, Fit: fitContain})
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(scaled, scaled.Bounds(), background, image.Point{}, draw.Src)
+	draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), src, bounds, draw.Over, nil)
+	return scaled
+}
+
+//dominantColor returns the most common color in `img` as a CSS hex color.
+//Similar colors are grouped together, and the result is the average of
+//the largest group.
+func dominantColor(img *image.RGBA) string {
+	type bucket struct {
+		r, g, b, n int
+	}
+	buckets := map[int]*bucket{}
+	var largest *bucket
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			key := int(c.R>>4)<<8 | int(c.G>>4)<<4 | int(c.B>>4)
+			b := buckets[key]
+			if b == nil {
+				b = &bucket{}
+				buckets[key] = b
+			}
+			b.r += int(c.R)
+			b.g += int(c.G)
+			b.b += int(c.B)
+			b.n++
+			if largest == nil || b.n > largest.n {
+				largest = b
+			}
+		}
+	}
+	if largest == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", largest.r/largest.n, largest.g/largest.n, largest.b/largest.n)
+}
+
+//blurHash encodes `img` as a BlurHash (https://blurha.sh), using more
+//components along the longer side of the image.
+func blurHash(img *image.RGBA) string {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return ""
+	}
+	xComponents, yComponents := blurHashComponents, blurHashComponents-1
+	if height > width {
+		xComponents, yComponents = yComponents, xComponents
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					c := img.RGBAAt(bounds.Min.X+x, bounds.Min.Y+y)
+					factor[0] += basis * srgbToLinear(c.R)
+					factor[1] += basis * srgbToLinear(c.G)
+					factor[2] += basis * srgbToLinear(c.B)
+				}
+			}
+			normalization := 2.0
+			if i == 0 && j == 0 {
+				normalization = 1
+			}
+			scale := normalization / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	dc, ac := factors[0], factors[1:]
+	hash := &strings.Builder{}
+	encodeBase83(hash, (xComponents-1)+(yComponents-1)*9, 1)
+
+	maximum := 1.0
+	if len(ac) > 0 {
+		actualMaximum := 0.0
+		for _, f := range ac {
+			for _, v := range f {
+				actualMaximum = math.Max(actualMaximum, math.Abs(v))
+			}
+		}
+		quantized := int(math.Max(0, math.Min(82, math.Floor(actualMaximum*166-0.5))))
+		maximum = float64(quantized+1) / 166
+		encodeBase83(hash, quantized, 1)
+	} else {
+		encodeBase83(hash, 0, 1)
+	}
+
+	encodeBase83(hash, linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4)
+	for _, f := range ac {
+		quantize := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signedPow(v/maximum, 0.5)*9+9.5))))
+		}
+		encodeBase83(hash, quantize(f[0])*19*19+quantize(f[1])*19+quantize(f[2]), 2)
+	}
+	return hash.String()
+}
+
+//encodeBase83 writes `value` to `sb` as `length` base 83 digits.
+func encodeBase83(sb *strings.Builder, value int, length int) {
+	for i := length - 1; i >= 0; i-- {
+		digit := (value / int(math.Pow(83, float64(i)))) % 83
+		sb.WriteByte(blurHashCharacters[digit])
+	}
+}
+
+//srgbToLinear converts an sRGB color component to linear light.
+func srgbToLinear(c uint8) float64 {
+	v := float64(c) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+//linearToSRGB converts a linear light color component to sRGB.
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+//signedPow raises the magnitude of `v` to `exp`, keeping its sign.
+func signedPow(v float64, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
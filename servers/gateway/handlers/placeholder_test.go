@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"Assignment1Summary/summary"
+)
+
+func decodeBase83(s string) int {
+	value := 0
+	for _, c := range s {
+		value = value*83 + strings.IndexRune(blurHashCharacters, c)
+	}
+	return value
+}
+
+func TestAddImagePlaceholders(t *testing.T) {
+	//a wide image that is mostly red with a blue stripe
+	img := image.NewRGBA(image.Rect(0, 0, 120, 60))
+	for y := 0; y < 60; y++ {
+		for x := 0; x < 120; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= 100 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	buf := &bytes.Buffer{}
+	png.Encode(buf, img)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/image.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	images := []*summary.PreviewImage{
+		{URL: server.URL + "/image.png"},
+		{URL: server.URL + "/missing.png"},
+		{URL: server.URL + "/missing.png", SecureURL: server.URL + "/image.png"},
+	}
+	addImagePlaceholders(context.Background(), images)
+
+	if images[0].Color != "#ff0000" {
+		t.Errorf("expected dominant color #ff0000 but got %q", images[0].Color)
+	}
+	hash := images[0].BlurHash
+	if len(hash) != 6+2*(4*3-1) {
+		t.Fatalf("expected a BlurHash with 4x3 components but got %q", hash)
+	}
+	if size := decodeBase83(hash[:1]); size != (4-1)+(3-1)*9 {
+		t.Errorf("expected the BlurHash size flag for 4x3 components but got %d", size)
+	}
+	dc := decodeBase83(hash[2:6])
+	if r, b := dc>>16, dc&0xff; r < 200 || b < 30 {
+		t.Errorf("expected the BlurHash average color to be mostly red with some blue, but got #%06x", dc)
+	}
+	if images[1].Color != "" || images[1].BlurHash != "" {
+		t.Errorf("expected no placeholders for an image that failed to load")
+	}
+	if images[2].Color != "#ff0000" {
+		t.Errorf("expected the secure URL to be fetched, but got dominant color %q", images[2].Color)
+	}
+}
+
+func TestBlurHashPortrait(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 20))
+	hash := blurHash(img)
+	if size := decodeBase83(hash[:1]); size != (3-1)+(4-1)*9 {
+		t.Errorf("expected portrait images to use 3x4 components but got size flag %d", size)
+	}
+}
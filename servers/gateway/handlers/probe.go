@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"Assignment1Summary/summary"
+)
+
+//probeBytes is how much of each image we request when probing.
+//Image dimensions are near the start of the file, though JPEGs
+//with large embedded metadata may need more than a few bytes.
+const probeBytes = 64 << 10
+
+//maxProbedImages limits how many images we probe for a single page.
+const maxProbedImages = 10
+
+//idealImageAspect is the aspect ratio of the 1200x630
+//image size recommended for link previews.
+const idealImageAspect = 1200.0 / 630.0
+
+//minPreviewImageSize is the smallest width or height we consider
+//big enough to be a card preview rather than an icon or spacer.
+const minPreviewImageSize = 100
+
+//probeImages fetches the first bytes of the first maxProbedImages images
+//to determine their actual type and dimensions. Probed images that can't
+//be fetched or aren't images are dropped, and the rest are sorted by their
+//suitability for a card preview. Any further images follow them, unprobed
+//and in their original order.
+func probeImages(ctx context.Context, images []*summary.PreviewImage) []*summary.PreviewImage {
+	var unprobed []*summary.PreviewImage
+	if len(images) > maxProbedImages {
+		images, unprobed = images[:maxProbedImages], images[maxProbedImages:]
+	}
+
+	probed := make([]*summary.PreviewImage, len(images))
+	wg := sync.WaitGroup{}
+	for i, img := range images {
+		wg.Add(1)
+		go func(i int, img *summary.PreviewImage) {
+			defer wg.Done()
+			if err := probeImage(ctx, img); err == nil {
+				probed[i] = img
+			}
+		}(i, img)
+	}
+	wg.Wait()
+
+	var valid []*summary.PreviewImage
+	for _, img := range probed {
+		if img != nil {
+			valid = append(valid, img)
+		}
+	}
+	sort.SliceStable(valid, func(i, j int) bool {
+		return imageSuitability(valid[i]) > imageSuitability(valid[j])
+	})
+	return append(valid, unprobed...)
+}
+
+//probeImage requests the first probeBytes of `img` and updates its type
+//and dimensions from the image header. An error is returned if the image
+//can't be fetched or isn't an image.
+func probeImage(ctx context.Context, img *summary.PreviewImage) error {
+	imgURL := img.URL
+	if len(img.SecureURL) > 0 {
+		imgURL = img.SecureURL
+	}
+	page, err := Fetcher.FetchRange(ctx, imgURL, fmt.Sprintf("0-%d", probeBytes-1))
+	if err != nil {
+		return err
+	}
+	defer page.Body.Close()
+
+	header, err := summary.DecodeImageHeader(io.LimitReader(page.Body, probeBytes))
+	if err == nil {
+		img.Type = header.Type
+		img.Width = header.Width
+		img.Height = header.Height
+		return nil
+	}
+
+	//formats like SVG and ICO can't be decoded, but are still images
+	mediaType := page.MediaType()
+	if !strings.HasPrefix(mediaType, "image/") {
+		return fmt.Errorf("%s is not an image", imgURL)
+	}
+	img.Type = mediaType
+	return nil
+}
+
+//imageSuitability scores how well an image would work as a card preview:
+//bigger is better up to the recommended size, and aspect ratios close to
+//the recommended one are better. Images of unknown size score zero.
+func imageSuitability(img *summary.PreviewImage) float64 {
+	if img.Width <= 0 || img.Height <= 0 {
+		return 0
+	}
+	width := float64(img.Width)
+	height := float64(img.Height)
+	size := math.Min(width*height/(1200*630), 1)
+	aspect := math.Abs(math.Log(width / height / idealImageAspect))
+	score := size / (1 + 2*aspect)
+	if img.Width < minPreviewImageSize || img.Height < minPreviewImageSize {
+		score /= 10
+	}
+	return score
+}
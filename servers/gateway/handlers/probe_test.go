@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"Assignment1Summary/internal/testimage"
+	"Assignment1Summary/summary"
+)
+
+func TestProbeImages(t *testing.T) {
+	files := map[string][]byte{
+		"/icon.png":   testimage.Encode(t, "png", 32, 32),
+		"/square.gif": testimage.Encode(t, "gif", 400, 400),
+		"/wide.png":   testimage.Encode(t, "png", 1200, 630),
+		"/page.html":  []byte("<html><head><title>not an image</title></head></html>"),
+	}
+	ranges := 0
+	mx := sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.Header.Get("Range")) > 0 {
+			mx.Lock()
+			ranges++
+			mx.Unlock()
+		}
+		data, found := files[r.URL.Path]
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	images := []*summary.PreviewImage{
+		{URL: server.URL + "/icon.png"},
+		{URL: server.URL + "/missing.png"},
+		{URL: server.URL + "/square.gif", Width: 10, Height: 10},
+		{URL: server.URL + "/page.html"},
+		{URL: server.URL + "/wide.png"},
+	}
+	probed := probeImages(context.Background(), images)
+
+	expected := []*summary.PreviewImage{
+		{URL: server.URL + "/wide.png", Type: "image/png", Width: 1200, Height: 630},
+		{URL: server.URL + "/square.gif", Type: "image/gif", Width: 400, Height: 400},
+		{URL: server.URL + "/icon.png", Type: "image/png", Width: 32, Height: 32},
+	}
+	if len(probed) != len(expected) {
+		t.Fatalf("expected %d images after probing but got %d\nHINT: images that 404 or aren't images should be dropped", len(expected), len(probed))
+	}
+	for i, img := range probed {
+		if *img != *expected[i] {
+			t.Errorf("image %d: expected %+v but got %+v\nHINT: images should be sorted by suitability with their actual dimensions", i, expected[i], img)
+		}
+	}
+	if ranges != len(images) {
+		t.Errorf("expected %d Range requests but got %d", len(images), ranges)
+	}
+
+	//images past the limit are kept unprobed, after the probed ones
+	many := []*summary.PreviewImage{}
+	for i := 0; i < maxProbedImages; i++ {
+		many = append(many, &summary.PreviewImage{URL: server.URL + "/icon.png"})
+	}
+	extra := []*summary.PreviewImage{{URL: server.URL + "/missing.png"}, {URL: server.URL + "/wide.png"}}
+	probed = probeImages(context.Background(), append(many, extra...))
+	if len(probed) != maxProbedImages+len(extra) {
+		t.Fatalf("expected %d images but got %d\nHINT: images past the limit shouldn't be dropped", maxProbedImages+len(extra), len(probed))
+	}
+	for i, img := range extra {
+		if actual := probed[maxProbedImages+i]; actual != img || actual.Width != 0 {
+			t.Errorf("extra image %d: expected %+v to be returned unprobed but got %+v\nHINT: images past the limit should follow the probed ones in their original order", i, img, actual)
+		}
+	}
+}
@@ -1,261 +1,205 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"golang.org/x/net/html"
 	"io"
+	"log"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
+
+	"Assignment1Summary/summary"
 )
 
-//PreviewImage represents a preview image for a page
-type PreviewImage struct {
-	URL       string `json:"url,omitempty"`
-	SecureURL string `json:"secureURL,omitempty"`
-	Type      string `json:"type,omitempty"`
-	Width     int    `json:"width,omitempty"`
-	Height    int    `json:"height,omitempty"`
-	Alt       string `json:"alt,omitempty"`
-}
+//Fetcher fetches and summarizes pages for all of the handlers.
+//main configures it from environment variables.
+var Fetcher = summary.NewFetcher()
 
-//PageSummary represents summary properties for a web page
-type PageSummary struct {
-	Type        string          `json:"type,omitempty"`
-	URL         string          `json:"url,omitempty"`
-	Title       string          `json:"title,omitempty"`
-	SiteName    string          `json:"siteName,omitempty"`
-	Description string          `json:"description,omitempty"`
-	Author      string          `json:"author,omitempty"`
-	Keywords    []string        `json:"keywords,omitempty"`
-	Icon        *PreviewImage   `json:"icon,omitempty"`
-	Images      []*PreviewImage `json:"images,omitempty"`
-}
+//hostBusyRetryAfter is how long, in seconds, clients are asked to wait
+//before retrying a page whose host has too many requests in flight.
+const hostBusyRetryAfter = 5
+
+//maxFormOverheadBytes is how much larger than the HTML
+//a multipart/form-data upload of it may be.
+const maxFormOverheadBytes = 64 << 10
 
 //SummaryHandler handles requests for the page summary API.
 //This API expects one query string parameter named `url`,
 //which should contain a URL to a web page. It responds with
-//a JSON-encoded PageSummary struct containing the page summary
-//meta-data.
+//a JSON-encoded summary.PageSummary struct containing the page summary
+//meta-data. If the optional `probe` parameter is "true", the page's
+//images are probed to fill in their dimensions, drop broken images,
+//and sort them by suitability for a preview. If the optional
+//`placeholders` parameter is "true", the images are fetched to compute
+//their dominant colors and BlurHash strings. If the optional `debug`
+//parameter is "provenance", the response also says which extractor
+//and element each field came from, and what alternative values were
+//seen.
+//
+//If the optional `proxy` parameter is "true", the icon and image URLs
+//are replaced with signed URLs on the image proxy API. This is an error
+//if ImageProxySecret isn't set.
+//
+//A POST request summarizes the HTML in the request body instead of
+//fetching a page, for HTML that isn't publicly reachable. The body is
+//either the raw HTML or a multipart/form-data upload with the HTML in a
+//part named `html`. The optional `url` parameter is then the base URL
+//for resolving relative URLs, and the rules for its host are applied.
+//Other methods aren't allowed.
 func SummaryHandler(w http.ResponseWriter, r *http.Request) {
-	/*TODO: add code and additional functions to do the following:
-	- Add an HTTP header to the response with the name
-	 `Access-Control-Allow-Origin` and a value of `*`. This will
-	  allow cross-origin AJAX requests to your server.
-	- Get the `url` query string parameter value from the request.
-	  If not supplied, respond with an http.StatusBadRequest error.
-	- Call fetchHTML() to fetch the requested URL. See comments in that
-	  function for more details.
-	- Call extractSummary() to extract the page summary meta-data,
-	  as directed in the assignment. See comments in that function
-	  for more details
-	- Close the response HTML stream so that you don't leak resources.
-	- Finally, respond with a JSON-encoded version of the PageSummary
-	  struct. That way the client can easily parse the JSON back into
-	  an object. Remember to tell the client that the response content
-	  type is JSON.
-
-	Helpful Links:
-	https://golang.org/pkg/net/http/#Request.FormValue
-	https://golang.org/pkg/net/http/#Error
-	https://golang.org/pkg/encoding/json/#NewEncoder
-	*/
 	w.Header().Add("Access-Control-Allow-Origin", "*")
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method must be GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
 	w.Header().Add("Content-Type", "application/json")
 	url := r.URL.Query().Get("url")
-	if len(url) == 0 {
+	if len(url) == 0 && r.Method != http.MethodPost {
 		http.Error(w, "No query found in the requested url", http.StatusBadRequest)
+		return
 	}
-	response, err := fetchHTML(url)
-	if err != nil {
-		log.Fatal("could not fetch url ")
+	if r.URL.Query().Get("proxy") == "true" && len(ImageProxySecret) == 0 {
+		http.Error(w, "the image proxy API is disabled", http.StatusBadRequest)
+		return
+	}
+	opts := Fetcher.Options()
+	switch debug := r.URL.Query().Get("debug"); debug {
+	case "":
+	case "provenance":
+		opts.Provenance = true
+	default:
+		http.Error(w, fmt.Sprintf("unknown debug mode %q", debug), http.StatusBadRequest)
+		return
+	}
+	var targetSummary *summary.PageSummary
+	var err error
+	if r.Method == http.MethodPost {
+		targetSummary, err = summarizeSubmittedHTML(w, r, url, opts)
+	} else {
+		targetSummary, err = Fetcher.SummarizeWith(r.Context(), url, opts)
 	}
-	targetSummary, err := extractSummary(url, response)
 	if err != nil {
-		log.Fatal("error extracting summary")
+		//errors summarizing submitted HTML are the client's, while
+		//errors fetching a page are normally the upstream server's
+		status := http.StatusBadGateway
+		if r.Method == http.MethodPost {
+			status = http.StatusBadRequest
+		}
+		writeSummaryError(w, err, status)
+		return
+	}
+	if r.URL.Query().Get("probe") == "true" {
+		targetSummary.Images = probeImages(r.Context(), targetSummary.Images)
+	}
+	if r.URL.Query().Get("placeholders") == "true" {
+		addImagePlaceholders(r.Context(), targetSummary.Images)
+	}
+	if r.URL.Query().Get("proxy") == "true" {
+		proxyImageURLs(targetSummary, requestBaseURL(r))
 	}
 	jsonError := json.NewEncoder(w).Encode(targetSummary)
 	if jsonError != nil {
-		log.Fatal("Error encoding the summary to json")
+		log.Printf("error encoding the summary to json: %v", jsonError)
 	}
-
 }
 
-//fetchHTML fetches `pageURL` and returns the body stream or an error.
-//Errors are returned if the response status code is an error (>=400),
-//or if the content type indicates the URL is not an HTML page.
-func fetchHTML(pageURL string) (io.ReadCloser, error) {
-	/*TODO: Do an HTTP GET for the page URL. If the response status
-	code is >= 400, return a nil stream and an error. If the response
-	content type does not indicate that the content is a web page, return
-	a nil stream and an error. Otherwise return the response body and
-	no (nil) error.
-
-	To test your implementation of this function, run the TestFetchHTML
-	test in summary_test.go. You can do that directly in Visual Studio Code,
-	or at the command line by running:
-		go test -run TestFetchHTML
-
-	Helpful Links:
-	https://golang.org/pkg/net/http/#Get
-	*/
-	resp, err := http.Get(pageURL)
-
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("response status code was %d", resp.StatusCode)
-	}
-
-	ctype := resp.Header.Get("Content-Type")
-	if !strings.HasPrefix(ctype, "text/html") {
-		return nil, fmt.Errorf("response content type was %s, not text/html", ctype)
+//writeSummaryError responds with the error `err` from summarizing a page.
+//The status code says whether the request, our own limits on requests to
+//the page's host, or a timeout is to blame. Other errors get `status`.
+func writeSummaryError(w http.ResponseWriter, err error, status int) {
+	var tooLarge *http.MaxBytesError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &tooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, summary.ErrInvalidURL):
+		status = http.StatusBadRequest
+	case errors.Is(err, summary.ErrCircuitOpen):
+		status = http.StatusServiceUnavailable
+		cooldown := Fetcher.BreakerCooldown
+		if cooldown <= 0 {
+			cooldown = summary.DefaultBreakerCooldown
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(cooldown.Seconds()))))
+	case errors.Is(err, summary.ErrHostBusy):
+		status = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", strconv.Itoa(hostBusyRetryAfter))
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		status = http.StatusGatewayTimeout
 	}
-
-	return resp.Body, err
+	http.Error(w, fmt.Sprintf("error summarizing page: %v", err), status)
 }
 
-//extractSummary tokenizes the `htmlStream` and populates a PageSummary
-//struct with the page's summary meta-data.
-func extractSummary(pageURL string, htmlStream io.ReadCloser) (*PageSummary, error) {
-	/*TODO: tokenize the `htmlStream` and extract the page summary meta-data
-	according to the assignment description.
-
-	To test your implementation of this function, run the TestExtractSummary
-	test in summary_test.go. You can do that directly in Visual Studio Code,
-	or at the command line by running:
-		go test -run TestExtractSummary
-	Helpful Links:
-	https://drstearns.github.io/tutorials/tokenizing/
-	http://ogp.me/
-	https://developers.facebook.com/docs/reference/opengraph/
-	https://golang.org/pkg/net/url/#URL.ResolveReference
-	*/
-	resSummary := &PageSummary{}
-
-	tokenizer := html.NewTokenizer(htmlStream)
-
-	for {
-		tokenType := tokenizer.Next()
-		token := tokenizer.Token()
-		if tokenType == html.ErrorToken {
-			err := tokenizer.Err()
-			if err == io.EOF {
-				break
-			}
-			return nil, err
+//summarizeSubmittedHTML summarizes the HTML in the body of `r`, resolving
+//relative URLs against `baseURL`. HTML longer than opts.MaxBytes, or
+//summary.DefaultMaxBytes if that is zero, is rejected with an
+//*http.MaxBytesError.
+func summarizeSubmittedHTML(w http.ResponseWriter, r *http.Request, baseURL string, opts *summary.Options) (*summary.PageSummary, error) {
+	if len(baseURL) > 0 {
+		u, err := url.Parse(baseURL)
+		if err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("the base url must be an absolute http or https URL")
 		}
-		if tokenType == html.StartTagToken || tokenType == html.SelfClosingTagToken {
-			if token.Data == "meta" {
-				property := getTargetAttr(token, "property")
-				name := getTargetAttr(token, "name")
-				content := getTargetAttr(token, "content")
-				switch property {
-				case "og:type":
-					resSummary.Type = content
-				case "og:url":
-					resSummary.URL = content
-				case "og:title":
-					resSummary.Title = content
-				case "og:site_name":
-					resSummary.SiteName = content
-				}
-				if property == "og:description" {
-					resSummary.Description = content
-				} else if name == "description" && resSummary.Description == "" {
-					resSummary.Description = content
-				}
-
-				if name == "author" {
-					resSummary.Author = content
-				}
-
-				if name == "keywords" {
-					arr := strings.Split(content, ",")
-					for i := range arr {
-						arr[i] = strings.TrimSpace(arr[i])
-					}
-					resSummary.Keywords = arr
-				}
-
-				if strings.HasPrefix(property, "og:image") {
-					if strings.HasPrefix(property, "og:image:") {
-						recentImage := resSummary.Images[len(resSummary.Images)-1]
-						switch property {
-						case "og:image:secure_url":
-							recentImage.SecureURL = getAbsoluteURL(pageURL, content)
-						case "og:image:alt":
-							recentImage.Alt = content
-						case "og:image:type":
-							recentImage.Type = content
-						case "og:image:width":
-							recentImage.Width, _ = strconv.Atoi(content)
-						case "og:image:height":
-							recentImage.Height, _ = strconv.Atoi(content)
-						}
-					} else {
-						newImg := &PreviewImage{}
-						if !strings.HasPrefix(content, "http://") {
-							content= getAbsoluteURL(pageURL, content)
-						}
-						newImg.URL = content
-						resSummary.Images = append(
-							resSummary.Images, newImg)
-					}
-				}
-			}
-			if token.Data == "title" && resSummary.Title == "" {
-				next := tokenizer.Next()
-				if next == html.TextToken {
-					resSummary.Title = tokenizer.Token().Data
-				}
-			}
-
-			if token.Data == "link" {
-				icon := &PreviewImage{}
-				rel := getTargetAttr(token, "rel")
-				if rel == "icon" {
-					icon.URL = getTargetAttr(token, "href")
-					icon.Type = getTargetAttr(token, "type")
-					icon.Alt  = getTargetAttr(token, "alt")
-					sizes  := getTargetAttr(token, "sizes")
-
-					if !strings.HasPrefix(icon.URL, "http://") {
-						relative, _ := url.Parse(icon.URL)
-						absolutePattern, _ := url.Parse(pageURL)
-						icon.URL = absolutePattern.ResolveReference(relative).String()
-					}
-					if sizes != "any" && sizes != "" {
-						sizeSlice := strings.Split(sizes, "x")
-						icon.Height, _ = strconv.Atoi(sizeSlice[0])
-						icon.Width, _ = strconv.Atoi(sizeSlice[1])
-					}
-				}
-				resSummary.Icon = icon
-			}
-		}
-
-		if tokenType == html.EndTagToken && token.Data == "head" {
-			break
+	}
+	maxBytes := opts.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = summary.DefaultMaxBytes
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isForm := mediaType == "multipart/form-data"
+	limit := maxBytes
+	if isForm {
+		limit += maxFormOverheadBytes
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	body := io.Reader(r.Body)
+	if isForm {
+		part, err := findFormPart(r, "html")
+		if err != nil {
+			return nil, err
 		}
+		defer part.Close()
+		body = part
 	}
-	return resSummary, nil
+	//read all of the HTML first, since Extract
+	//would quietly stop reading at the limit
+	html, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(html)) > maxBytes {
+		return nil, &http.MaxBytesError{Limit: maxBytes}
+	}
+	return summary.Extract(r.Context(), bytes.NewReader(html), baseURL, opts)
 }
 
-
-func getTargetAttr(token html.Token, target string) string {
-	for _, a := range token.Attr {
-		if a.Key == target {
-			return a.Val
+//findFormPart returns the part of the multipart/form-data body of `r`
+//named `name`, skipping any parts before it.
+func findFormPart(r *http.Request, name string) (*multipart.Part, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no %q part found in the form", name)
 		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == name {
+			return part, nil
+		}
+		part.Close()
 	}
-	return ""
 }
-
-func getAbsoluteURL(absoluteBase string, relative string) string {
-	absoluteURL, _ := url.Parse(absoluteBase)
-	relativeURL, _ := url.Parse(relative)
-	return absoluteURL.ResolveReference(relativeURL).String()
-}
-
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+//ThumbnailCacheDir is the directory where resized images are cached.
+//main sets this from the THUMBNAIL_CACHE_DIR environment variable.
+//If it is empty, thumbnails are not cached.
+var ThumbnailCacheDir = ""
+
+//ThumbnailCacheMaxBytes is the most space cached thumbnails may take up.
+//main sets this from the THUMBNAIL_CACHE_MAX_BYTES environment variable.
+//When a new thumbnail takes the cache over it, the least recently used
+//thumbnails are removed. If it is zero, the cache may grow without bound.
+var ThumbnailCacheMaxBytes int64 = 256 << 20
+
+//thumbnailTempPrefix is the file name prefix of thumbnails being written.
+const thumbnailTempPrefix = ".thumbnail-"
+
+//maxThumbnailSize is the largest width or height a client may request.
+const maxThumbnailSize = 2048
+
+//maxDecodedPixels limits the size of images we decode to make
+//thumbnails, since a small file can declare enormous dimensions.
+const maxDecodedPixels = 50 * 1000 * 1000
+
+//maxConcurrentDecodes limits how many images we decode at once, since
+//each decoded image can take up to 4 bytes per pixel of memory.
+const maxConcurrentDecodes = 4
+
+//decodeSlots holds a value for each image being decoded.
+var decodeSlots = make(chan struct{}, maxConcurrentDecodes)
+
+//thumbnailJPEGQuality is the quality used to encode opaque thumbnails.
+const thumbnailJPEGQuality = 85
+
+//Ways a thumbnail can fit the requested width and height.
+const (
+	//fitContain scales the image to fit within the requested size.
+	fitContain = "contain"
+	//fitCover scales the image to cover the requested size,
+	//cropping whatever extends past it from the center.
+	fitCover = "cover"
+)
+
+//thumbnailOptions are the resizing parameters of an image proxy request.
+type thumbnailOptions struct {
+	Width  int
+	Height int
+	Fit    string
+}
+
+//parseThumbnailOptions reads the `w`, `h` and `fit` query string
+//parameters. It returns nil if no resizing was requested.
+func parseThumbnailOptions(query url.Values) (*thumbnailOptions, error) {
+	if len(query.Get("w")) == 0 && len(query.Get("h")) == 0 {
+		return nil, nil
+	}
+	opts := &thumbnailOptions{Fit: query.Get("fit")}
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{{"w", &opts.Width}, {"h", &opts.Height}} {
+		s := query.Get(p.name)
+		if len(s) == 0 {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxThumbnailSize {
+			return nil, fmt.Errorf("%s must be a number between 1 and %d", p.name, maxThumbnailSize)
+		}
+		*p.value = n
+	}
+	switch opts.Fit {
+	case "":
+		opts.Fit = fitContain
+	case fitContain, fitCover:
+	default:
+		return nil, fmt.Errorf("fit must be %q or %q", fitContain, fitCover)
+	}
+	return opts, nil
+}
+
+//thumbnailGeometry returns the size of the thumbnail for a `srcWidth` by
+//`srcHeight` image, and the rectangle of the source image it shows.
+//Images are never scaled up.
+func thumbnailGeometry(srcWidth int, srcHeight int, opts *thumbnailOptions) (int, int, image.Rectangle) {
+	full := image.Rect(0, 0, srcWidth, srcHeight)
+	scaleX := math.Inf(1)
+	if opts.Width > 0 {
+		scaleX = float64(opts.Width) / float64(srcWidth)
+	}
+	scaleY := math.Inf(1)
+	if opts.Height > 0 {
+		scaleY = float64(opts.Height) / float64(srcHeight)
+	}
+
+	if opts.Fit == fitCover && opts.Width > 0 && opts.Height > 0 {
+		scale := math.Max(scaleX, scaleY)
+		width, height := float64(opts.Width), float64(opts.Height)
+		if scale > 1 {
+			//keep the requested aspect ratio, but don't scale up
+			width /= scale
+			height /= scale
+			scale = 1
+		}
+		cropWidth := int(math.Round(width / scale))
+		cropHeight := int(math.Round(height / scale))
+		x := (srcWidth - cropWidth) / 2
+		y := (srcHeight - cropHeight) / 2
+		crop := image.Rect(x, y, x+cropWidth, y+cropHeight).Intersect(full)
+		return atLeastOne(width), atLeastOne(height), crop
+	}
+
+	scale := math.Min(math.Min(scaleX, scaleY), 1)
+	return atLeastOne(float64(srcWidth) * scale), atLeastOne(float64(srcHeight) * scale), full
+}
+
+//atLeastOne rounds `n` to the nearest integer, but no lower than 1.
+func atLeastOne(n float64) int {
+	return int(math.Max(math.Round(n), 1))
+}
+
+//makeThumbnail decodes a JPEG, PNG, GIF or WebP image, resizes it, and
+//re-encodes it, returning the encoded thumbnail and its media type.
+//Opaque thumbnails are encoded as JPEG and the rest as PNG.
+func makeThumbnail(ctx context.Context, data []byte, opts *thumbnailOptions) ([]byte, string, error) {
+	var dst *image.RGBA
+	err := withDecodedImage(ctx, data, func(src image.Image) error {
+		bounds := src.Bounds()
+		width, height, crop := thumbnailGeometry(bounds.Dx(), bounds.Dy(), opts)
+		dst = image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop.Add(bounds.Min), draw.Src, nil)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	buf := &bytes.Buffer{}
+	if dst.Opaque() {
+		err = jpeg.Encode(buf, dst, &jpeg.Options{Quality: thumbnailJPEGQuality})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(buf, dst)
+	return buf.Bytes(), "image/png", err
+}
+
+//withDecodedImage decodes `data` with decodeImage and calls `use` with
+//the decoded image. At most maxConcurrentDecodes images are decoded and
+//used at once, and it waits for its turn until `ctx` is done.
+func withDecodedImage(ctx context.Context, data []byte, use func(image.Image) error) error {
+	select {
+	case decodeSlots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-decodeSlots }()
+	src, err := decodeImage(data)
+	if err != nil {
+		return err
+	}
+	return use(src)
+}
+
+//decodeImage decodes a JPEG, PNG, GIF or WebP image, first checking
+//that it isn't too large to decode.
+func decodeImage(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxDecodedPixels {
+		return nil, fmt.Errorf("image is too large to decode: %dx%d", config.Width, config.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	return src, err
+}
+
+//thumbnailCachePath returns the path of the cached thumbnail of `imgURL`
+//with the given options and media type.
+func thumbnailCachePath(imgURL string, opts *thumbnailOptions, mediaType string) string {
+	key := sha256.Sum256([]byte(fmt.Sprintf("%s\n%d\n%d\n%s", imgURL, opts.Width, opts.Height, opts.Fit)))
+	ext := ".png"
+	if mediaType == "image/jpeg" {
+		ext = ".jpg"
+	}
+	return filepath.Join(ThumbnailCacheDir, hex.EncodeToString(key[:])+ext)
+}
+
+//cachedThumbnail returns the cached thumbnail of `imgURL` with the
+//given options and its media type, or nil if it isn't cached.
+func cachedThumbnail(imgURL string, opts *thumbnailOptions) ([]byte, string) {
+	if len(ThumbnailCacheDir) == 0 {
+		return nil, ""
+	}
+	for _, mediaType := range []string{"image/jpeg", "image/png"} {
+		path := thumbnailCachePath(imgURL, opts, mediaType)
+		if data, err := os.ReadFile(path); err == nil {
+			//the modification time is when the thumbnail was last used
+			now := time.Now()
+			os.Chtimes(path, now, now)
+			return data, mediaType
+		}
+	}
+	return nil, ""
+}
+
+//cacheThumbnail writes a thumbnail to the cache. It writes to a temporary
+//file first so that readers never see a partially written thumbnail.
+func cacheThumbnail(imgURL string, opts *thumbnailOptions, data []byte, mediaType string) error {
+	if len(ThumbnailCacheDir) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(ThumbnailCacheDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(ThumbnailCacheDir, thumbnailTempPrefix)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), thumbnailCachePath(imgURL, opts, mediaType)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return trimThumbnailCache(int64(len(data)))
+}
+
+//thumbnailCache tracks the size of the thumbnails in ThumbnailCacheDir.
+//The size is only an estimate, since a thumbnail written again is counted
+//twice, so the directory is read to get the actual sizes when the estimate
+//goes over ThumbnailCacheMaxBytes.
+var thumbnailCache struct {
+	mu sync.Mutex
+	//dir is the directory size is for, which is empty until it is read
+	dir  string
+	size int64
+}
+
+//trimThumbnailCache adds `added` bytes to the size of the thumbnail
+//cache, and if that takes it over ThumbnailCacheMaxBytes, removes the
+//least recently used thumbnails until it is no longer over.
+func trimThumbnailCache(added int64) error {
+	if ThumbnailCacheMaxBytes <= 0 {
+		return nil
+	}
+	thumbnailCache.mu.Lock()
+	defer thumbnailCache.mu.Unlock()
+	if thumbnailCache.dir == ThumbnailCacheDir {
+		thumbnailCache.size += added
+		if thumbnailCache.size <= ThumbnailCacheMaxBytes {
+			return nil
+		}
+	}
+
+	entries, err := os.ReadDir(ThumbnailCacheDir)
+	if err != nil {
+		return err
+	}
+	var thumbnails []os.FileInfo
+	var size int64
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), thumbnailTempPrefix) {
+			continue
+		}
+		//files removed since the directory was read are skipped
+		file, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		thumbnails = append(thumbnails, file)
+		size += file.Size()
+	}
+	sort.Slice(thumbnails, func(i, j int) bool {
+		return thumbnails[i].ModTime().Before(thumbnails[j].ModTime())
+	})
+	for _, file := range thumbnails {
+		if size <= ThumbnailCacheMaxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(ThumbnailCacheDir, file.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		size -= file.Size()
+	}
+	thumbnailCache.dir = ThumbnailCacheDir
+	thumbnailCache.size = size
+	return nil
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"Assignment1Summary/internal/testimage"
+)
+
+func TestThumbnailGeometry(t *testing.T) {
+	cases := []struct {
+		name           string
+		srcWidth       int
+		srcHeight      int
+		opts           thumbnailOptions
+		expectedWidth  int
+		expectedHeight int
+		expectedCrop   image.Rectangle
+	}{
+		{"Width Only", 1000, 500, thumbnailOptions{Width: 100, Fit: fitContain}, 100, 50, image.Rect(0, 0, 1000, 500)},
+		{"Height Only", 1000, 500, thumbnailOptions{Height: 100, Fit: fitContain}, 200, 100, image.Rect(0, 0, 1000, 500)},
+		{"Contain", 1000, 500, thumbnailOptions{Width: 100, Height: 100, Fit: fitContain}, 100, 50, image.Rect(0, 0, 1000, 500)},
+		{"Cover", 1000, 500, thumbnailOptions{Width: 100, Height: 100, Fit: fitCover}, 100, 100, image.Rect(250, 0, 750, 500)},
+		{"No Upscaling", 50, 40, thumbnailOptions{Width: 100, Fit: fitContain}, 50, 40, image.Rect(0, 0, 50, 40)},
+		{"Cover No Upscaling", 50, 40, thumbnailOptions{Width: 200, Height: 100, Fit: fitCover}, 50, 25, image.Rect(0, 7, 50, 32)},
+	}
+	for _, c := range cases {
+		width, height, crop := thumbnailGeometry(c.srcWidth, c.srcHeight, &c.opts)
+		if width != c.expectedWidth || height != c.expectedHeight || crop != c.expectedCrop {
+			t.Errorf("case %s: expected %dx%d from %v but got %dx%d from %v", c.name,
+				c.expectedWidth, c.expectedHeight, c.expectedCrop, width, height, crop)
+		}
+	}
+}
+
+func TestParseThumbnailOptions(t *testing.T) {
+	cases := []struct {
+		query       string
+		expected    *thumbnailOptions
+		expectError bool
+	}{
+		{"", nil, false},
+		{"w=120", &thumbnailOptions{Width: 120, Fit: fitContain}, false},
+		{"w=120&h=80&fit=cover", &thumbnailOptions{Width: 120, Height: 80, Fit: fitCover}, false},
+		{"w=0", nil, true},
+		{"h=100000", nil, true},
+		{"w=abc", nil, true},
+		{"w=10&fit=stretch", nil, true},
+	}
+	for _, c := range cases {
+		query, _ := url.ParseQuery(c.query)
+		opts, err := parseThumbnailOptions(query)
+		if (err != nil) != c.expectError {
+			t.Errorf("query %q: expected error %t but got %v", c.query, c.expectError, err)
+			continue
+		}
+		if (opts == nil) != (c.expected == nil) || (opts != nil && *opts != *c.expected) {
+			t.Errorf("query %q: expected %+v but got %+v", c.query, c.expected, opts)
+		}
+	}
+}
+
+func TestImageHandlerThumbnail(t *testing.T) {
+	requests := 0
+	png := testimage.Encode(t, "png", 400, 200)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	}))
+	defer upstream.Close()
+
+	dir, err := os.MkdirTemp("", "thumbnails")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ThumbnailCacheDir = dir
+	ImageProxySecret = []byte("test secret")
+	defer func() {
+		ThumbnailCacheDir = ""
+		ImageProxySecret = nil
+	}()
+
+	imgURL := upstream.URL + "/image.png"
+	query := url.Values{"url": {imgURL}, "sig": {signImageURL(imgURL)}, "w": {"100"}}
+	for i := 0; i < 2; i++ {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/image?"+query.Encode(), nil)
+		ImageHandler(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status code %d but got %d: %s", i, http.StatusOK, resp.Code, resp.Body.String())
+		}
+		if ctype := resp.Header().Get("Content-Type"); ctype != "image/jpeg" {
+			t.Errorf("request %d: expected opaque thumbnail to be a JPEG but got %s", i, ctype)
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(resp.Body.Bytes()))
+		if err != nil {
+			t.Fatalf("request %d: error decoding thumbnail: %v", i, err)
+		}
+		if config.Width != 100 || config.Height != 50 {
+			t.Errorf("request %d: expected a 100x50 thumbnail but got %dx%d", i, config.Width, config.Height)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected the second request to be served from the thumbnail cache, but the image was fetched %d times", requests)
+	}
+}
+
+func TestThumbnailCacheEviction(t *testing.T) {
+	ThumbnailCacheDir = t.TempDir()
+	ThumbnailCacheMaxBytes = 25
+	defer func() {
+		ThumbnailCacheDir = ""
+		ThumbnailCacheMaxBytes = 256 << 20
+	}()
+
+	//room for two 10 byte thumbnails
+	opts := &thumbnailOptions{Width: 100, Fit: fitContain}
+	data := []byte("0123456789")
+	for i, imgURL := range []string{"https://test.com/a.png", "https://test.com/b.png"} {
+		if err := cacheThumbnail(imgURL, opts, data, "image/png"); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		old := time.Now().Add(time.Duration(i-2) * time.Hour)
+		os.Chtimes(thumbnailCachePath(imgURL, opts, "image/png"), old, old)
+	}
+	if thumb, _ := cachedThumbnail("https://test.com/a.png", opts); thumb == nil {
+		t.Fatalf("expected a.png to be cached")
+	}
+	if err := cacheThumbnail("https://test.com/c.png", opts, data, "image/png"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if thumb, _ := cachedThumbnail("https://test.com/b.png", opts); thumb != nil {
+		t.Errorf("expected the least recently used thumbnail to be evicted")
+	}
+	for _, imgURL := range []string{"https://test.com/a.png", "https://test.com/c.png"} {
+		if thumb, _ := cachedThumbnail(imgURL, opts); thumb == nil {
+			t.Errorf("expected %s to be kept", imgURL)
+		}
+	}
+}
+
+func TestWithDecodedImage(t *testing.T) {
+	data := testimage.Encode(t, "png", 20, 10)
+	for i := 0; i < maxConcurrentDecodes; i++ {
+		decodeSlots <- struct{}{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := withDecodedImage(ctx, data, func(image.Image) error { return nil })
+	for i := 0; i < maxConcurrentDecodes; i++ {
+		<-decodeSlots
+	}
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected to give up waiting for a decode slot, but got %v", err)
+	}
+
+	var width int
+	err = withDecodedImage(context.Background(), data, func(img image.Image) error {
+		width = img.Bounds().Dx()
+		return nil
+	})
+	if err != nil || width != 20 {
+		t.Errorf("expected the decoded image, but got width %d, %v", width, err)
+	}
+}
@@ -2,11 +2,105 @@ package main
 
 import (
 	"Assignment1Summary/servers/gateway/handlers"
+	"Assignment1Summary/summary"
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
+//rulesReloadInterval is how often the extraction rules
+//file is checked for changes.
+const rulesReloadInterval = 5 * time.Second
+
+//cacheEntries is the number of page summaries kept in memory.
+const cacheEntries = 10000
+
+//defaultCacheMaxBytes is the default size limit of the disk cache.
+const defaultCacheMaxBytes = 1 << 30
+
+//Entries are removed from the disk cache every cacheExpiryInterval once
+//they are cacheMaxAge old, and the Redis server expires them at that
+//age. They are kept well past their TTL, since expired summaries can
+//still be revalidated.
+const (
+	cacheExpiryInterval = 10 * time.Minute
+	cacheMaxAge         = 7 * 24 * time.Hour
+)
+
+//The default times stale summaries are served while they are
+//refreshed, and failures to summarize pages are cached.
+const (
+	defaultStaleTTL      = 10 * time.Minute
+	defaultErrorCacheTTL = time.Minute
+)
+
+//The default limits on requests to each upstream host.
+const (
+	defaultHostRate        = 5
+	defaultHostBurst       = 10
+	defaultHostConcurrency = 4
+)
+
+//The default retries and circuit breaker threshold for upstream requests.
+const (
+	defaultRetries          = 2
+	defaultBreakerThreshold = 5
+)
+
+//envNumber returns the number in the environment variable `name`,
+//or `def` if it is empty.
+func envNumber(name string, def float64) float64 {
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		return def
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		log.Fatalf("%s must be a non-negative number, but is %q", name, value)
+	}
+	return n
+}
+
+//envDuration returns the duration in the environment variable `name`,
+//such as "30s", or `def` if it is empty.
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Fatalf("%s must be a non-negative duration such as \"30s\", but is %q", name, value)
+	}
+	return d
+}
+
+//prewarm crawls the sitemaps of each site to fill the summary cache,
+//logging the pages that are missing Open Graph meta-data.
+func prewarm(sites []string) {
+	crawler := &summary.Crawler{Fetcher: handlers.Fetcher}
+	for _, site := range sites {
+		report, err := crawler.Crawl(context.Background(), site)
+		if err != nil {
+			log.Printf("error prewarming %s: %v", site, err)
+			continue
+		}
+		for _, crawlErr := range report.Errors {
+			log.Printf("prewarming %s: error reading %s: %s", site, crawlErr.URL, crawlErr.Error)
+		}
+		for _, missing := range report.MissingOpenGraph {
+			log.Printf("prewarming %s: %s is missing %s", site, missing.URL, strings.Join(missing.Missing, ", "))
+		}
+		log.Printf("prewarmed %s: %d pages from %d sitemaps, %d errors, %d pages missing Open Graph meta-data",
+			site, report.Pages, len(report.Sitemaps), len(report.Errors), len(report.MissingOpenGraph))
+	}
+}
+
 //main is the main entry point for the server
 func main() {
 	/* TODO: add code to do the following
@@ -26,8 +120,109 @@ func main() {
 		addr = ":80"
 	}
 
+	mode, err := summary.ParseContentTypeMode(os.Getenv("CONTENT_TYPE_MODE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	handlers.Fetcher.ContentTypeMode = mode
+	handlers.Fetcher.UserAgent = os.Getenv("USER_AGENT")
+	if handlers.Fetcher.Robots, err = summary.ParseRobotsMode(os.Getenv("ROBOTS_MODE")); err != nil {
+		log.Fatal(err)
+	}
+	//requests per second, burst size and concurrent requests allowed
+	//to each upstream host, where a rate or concurrency of 0 means no limit
+	handlers.Fetcher.HostRate = envNumber("HOST_RATE_LIMIT", defaultHostRate)
+	handlers.Fetcher.HostBurst = int(envNumber("HOST_BURST", defaultHostBurst))
+	handlers.Fetcher.HostConcurrency = int(envNumber("HOST_CONCURRENCY", defaultHostConcurrency))
+	//retries of transient upstream failures, and the consecutive failures
+	//that open a host's circuit breaker, where 0 disables the breakers
+	handlers.Fetcher.Retries = int(envNumber("RETRIES", defaultRetries))
+	handlers.Fetcher.BreakerThreshold = int(envNumber("BREAKER_THRESHOLD", defaultBreakerThreshold))
+	handlers.Fetcher.BreakerCooldown = envDuration("BREAKER_COOLDOWN", summary.DefaultBreakerCooldown)
+	registry := summary.DefaultRegistry()
+	if extractors := os.Getenv("EXTRACTORS"); len(extractors) > 0 {
+		//a comma-separated list of extractors to use, in order of precedence
+		names := strings.Split(extractors, ",")
+		for i := range names {
+			names[i] = strings.TrimSpace(names[i])
+		}
+		if err := registry.Use(names...); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if rulesPath := os.Getenv("EXTRACTION_RULES"); len(rulesPath) > 0 {
+		rules, err := summary.LoadRulesFile(rulesPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		//site-specific rules take precedence over the generic extractors
+		if err := registry.RegisterBefore(registry.Names()[0], rules); err != nil {
+			log.Fatal(err)
+		}
+		go rules.Watch(context.Background(), rulesReloadInterval, func(err error) {
+			log.Printf("error reloading extraction rules: %v", err)
+		})
+	}
+	handlers.Fetcher.Registry = registry
+	//how long summaries are fresh for, or "0" to disable the cache,
+	//then how long stale summaries are served while they are refreshed,
+	//and how long failures are cached, or "0" to disable those
+	if cacheTTL := envDuration("CACHE_TTL", summary.DefaultCacheTTL); cacheTTL > 0 {
+		redisAddr := os.Getenv("REDIS_ADDR")
+		cacheDir := os.Getenv("CACHE_DIR")
+		switch {
+		case len(redisAddr) > 0:
+			//share the cache with the other gateways, on a Redis server
+			redisCache := summary.NewRedisCache(redisAddr)
+			redisCache.Password = os.Getenv("REDIS_PASSWORD")
+			redisCache.DB = int(envNumber("REDIS_DB", 0))
+			redisCache.TTL = cacheMaxAge
+			handlers.Fetcher.Cache = redisCache
+		case len(cacheDir) > 0:
+			//keep the cache on disk, so it survives restarts
+			diskCache, err := summary.NewDiskCache(cacheDir, int64(envNumber("CACHE_MAX_BYTES", defaultCacheMaxBytes)))
+			if err != nil {
+				log.Fatal(err)
+			}
+			go diskCache.ExpireEvery(context.Background(), cacheExpiryInterval, cacheMaxAge, func(err error) {
+				log.Printf("error expiring cache entries: %v", err)
+			})
+			handlers.Fetcher.Cache = diskCache
+		default:
+			handlers.Fetcher.Cache = summary.NewMemoryCache(cacheEntries)
+		}
+		handlers.Fetcher.CacheTTL = cacheTTL
+		handlers.Fetcher.StaleTTL = envDuration("STALE_TTL", defaultStaleTTL)
+		handlers.Fetcher.ErrorCacheTTL = envDuration("ERROR_CACHE_TTL", defaultErrorCacheTTL)
+	}
+	if sites := os.Getenv("PREWARM_SITEMAPS"); len(sites) > 0 {
+		//a comma-separated list of sites whose sitemaps are crawled
+		//at startup, to fill the cache
+		names := strings.Split(sites, ",")
+		for i := range names {
+			names[i] = strings.TrimSpace(names[i])
+		}
+		go prewarm(names)
+	}
+	handlers.ImageProxySecret = []byte(os.Getenv("IMAGE_PROXY_SECRET"))
+	handlers.ThumbnailCacheDir = os.Getenv("THUMBNAIL_CACHE_DIR")
+	if len(handlers.ThumbnailCacheDir) == 0 {
+		handlers.ThumbnailCacheDir = filepath.Join(os.TempDir(), "gateway-thumbnails")
+	}
+	handlers.ThumbnailCacheMaxBytes = int64(envNumber("THUMBNAIL_CACHE_MAX_BYTES", float64(handlers.ThumbnailCacheMaxBytes)))
+	handlers.AdminToken = os.Getenv("ADMIN_TOKEN")
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/v1/summary", handlers.SummaryHandler)
+	if len(handlers.ImageProxySecret) > 0 {
+		//without a secret, the image proxy would be an open proxy
+		mux.HandleFunc("/v1/image", handlers.ImageHandler)
+	}
+	mux.HandleFunc("/v1/card", handlers.CardHandler)
+	mux.HandleFunc("/v1/extract", handlers.ExtractHandler)
+	mux.HandleFunc("/v1/admin/breakers", handlers.BreakersHandler)
+	mux.HandleFunc("/v1/admin/cache", handlers.CacheHandler)
+	mux.HandleFunc("/v1/admin/cache/stats", handlers.CacheStatsHandler)
 
 	//start the web zipserver
 	log.Printf("server is listening at https://%s", addr)
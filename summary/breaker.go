@@ -0,0 +1,222 @@
+package summary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+//ErrCircuitOpen is returned without making a request when the host's
+//circuit breaker is open, because recent requests to it have failed.
+var ErrCircuitOpen = errors.New("circuit breaker is open for the host")
+
+//DefaultRetryBackoff is the default delay before the first retry.
+const DefaultRetryBackoff = 200 * time.Millisecond
+
+//maxRetryBackoff limits the delay before any retry.
+const maxRetryBackoff = 5 * time.Second
+
+//DefaultBreakerCooldown is the default time a circuit breaker
+//stays open before letting a trial request through.
+const DefaultBreakerCooldown = 30 * time.Second
+
+//The states of a host's circuit breaker.
+const (
+	//BreakerClosed lets requests through.
+	BreakerClosed = "closed"
+	//BreakerOpen fails requests without making them.
+	BreakerOpen = "open"
+	//BreakerHalfOpen lets one trial request through,
+	//which closes the breaker if it succeeds.
+	BreakerHalfOpen = "half-open"
+)
+
+//BreakerState describes the circuit breaker of a host.
+type BreakerState struct {
+	Host  string `json:"host"`
+	State string `json:"state"`
+	//Failures is the number of consecutive failed requests.
+	Failures int `json:"failures"`
+	//OpenUntil is when an open breaker lets a trial request through.
+	OpenUntil *time.Time `json:"openUntil,omitempty"`
+}
+
+//statusError is the error for an upstream response with an
+//error status code.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("response status code was %d", e.code)
+}
+
+//roundTripError is an error from the round trip of an upstream request,
+//as opposed to one from waiting for the request to start.
+type roundTripError struct {
+	err error
+}
+
+func (e *roundTripError) Error() string { return e.err.Error() }
+
+func (e *roundTripError) Unwrap() error { return e.err }
+
+//isTransient reports whether `err`, from a request made with `ctx`,
+//is a failure that may not happen again, such as a timeout, a dropped
+//connection, a temporary DNS failure or a 502, 503 or 504 response.
+//These are retried, and count against the host's circuit breaker.
+//Failures that would happen again, such as an invalid certificate or
+//too many redirects, aren't transient.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, errPrivateAddress) {
+		return false
+	}
+	//every error from http.Client.Do is a *url.Error, which is a
+	//net.Error whatever it wraps, so look at what it wraps instead
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code == http.StatusBadGateway ||
+			se.code == http.StatusServiceUnavailable ||
+			se.code == http.StatusGatewayTimeout
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+//retryBackoff returns the delay before retry number `attempt`, counting
+//from zero. It doubles with each attempt, and half of it is random, so
+//that clients retrying at once spread out.
+func (f *Fetcher) retryBackoff(attempt int) time.Duration {
+	d := f.RetryBackoff
+	if d <= 0 {
+		d = DefaultRetryBackoff
+	}
+	for i := 0; i < attempt && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+//sleepContext waits for `d`, or until `ctx` is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//breakerCooldown returns the effective BreakerCooldown of the fetcher.
+func (f *Fetcher) breakerCooldown() time.Duration {
+	if f.BreakerCooldown <= 0 {
+		return DefaultBreakerCooldown
+	}
+	return f.BreakerCooldown
+}
+
+//breakerAllow returns ErrCircuitOpen if the breaker of the host of `req`
+//is open, or is half-open with a trial request already in flight.
+//Otherwise the request may go ahead, and if the breaker is half-open,
+//it is the trial request, and true is returned. The caller must report
+//the outcome with breakerDone.
+func (f *Fetcher) breakerAllow(req *http.Request) (bool, error) {
+	if f.BreakerThreshold <= 0 {
+		return false, nil
+	}
+	f.hostLimits.mu.Lock()
+	defer f.hostLimits.mu.Unlock()
+	now := time.Now()
+	state := f.host(hostKey(req), now)
+	if state.failures < f.BreakerThreshold {
+		return false, nil
+	}
+	if now.Before(state.openedAt.Add(f.breakerCooldown())) || state.trial {
+		return false, fmt.Errorf("%s: %w", req.URL.Host, ErrCircuitOpen)
+	}
+	state.trial = true
+	return true, nil
+}
+
+//breakerDone records the outcome of a request that breakerAllow let
+//through. A nil `failed` means the request didn't finish, such as when
+//its context was cancelled, so it says nothing about the host. `trial`
+//is what breakerAllow returned, since only the trial request may let
+//another one through a half-open breaker.
+func (f *Fetcher) breakerDone(req *http.Request, trial bool, failed *bool) {
+	if f.BreakerThreshold <= 0 {
+		return
+	}
+	f.hostLimits.mu.Lock()
+	defer f.hostLimits.mu.Unlock()
+	now := time.Now()
+	state := f.host(hostKey(req), now)
+	if trial {
+		state.trial = false
+	}
+	switch {
+	case failed == nil:
+	case *failed:
+		state.failures++
+		if state.failures >= f.BreakerThreshold {
+			//this opens the breaker, or reopens it after a failed trial
+			state.openedAt = now
+		}
+	default:
+		state.failures = 0
+	}
+}
+
+//Breakers returns the state of the circuit breaker of every host
+//that has had failures recently, sorted by host.
+func (f *Fetcher) Breakers() []*BreakerState {
+	f.hostLimits.mu.Lock()
+	defer f.hostLimits.mu.Unlock()
+	now := time.Now()
+	states := []*BreakerState{}
+	for host, state := range f.hostLimits.hosts {
+		if state.failures == 0 {
+			continue
+		}
+		bs := &BreakerState{Host: host, State: BreakerClosed, Failures: state.failures}
+		if f.BreakerThreshold > 0 && state.failures >= f.BreakerThreshold {
+			openUntil := state.openedAt.Add(f.breakerCooldown())
+			if now.Before(openUntil) {
+				bs.State = BreakerOpen
+				bs.OpenUntil = &openUntil
+			} else {
+				bs.State = BreakerHalfOpen
+			}
+		}
+		states = append(states, bs)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Host < states[j].Host })
+	return states
+}
@@ -0,0 +1,264 @@
+package summary
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetcherRetries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/flaky":
+			if n < 3 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+		case "/missing":
+			http.NotFound(w, r)
+			return
+		case "/down":
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>Page</title></head></html>"))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		name             string
+		hint             string
+		path             string
+		expectError      bool
+		expectedRequests int32
+	}{
+		{
+			"Transient Failures",
+			"503 responses should be retried until one succeeds",
+			"/flaky",
+			false,
+			3,
+		},
+		{
+			"Permanent Failure",
+			"404 responses shouldn't be retried",
+			"/missing",
+			true,
+			1,
+		},
+		{
+			"Retries Exhausted",
+			"a request should be made once, then retried Retries times",
+			"/down",
+			true,
+			3,
+		},
+	}
+
+	for _, c := range cases {
+		f := newTestFetcher()
+		f.Retries = 2
+		f.RetryBackoff = time.Millisecond
+		atomic.StoreInt32(&requests, 0)
+		_, err := f.Summarize(context.Background(), server.URL+c.path)
+		if c.expectError && err == nil {
+			t.Errorf("case %s: expected an error but didn't get one\nHINT: %s", c.name, c.hint)
+		}
+		if !c.expectError && err != nil {
+			t.Errorf("case %s: unexpected error %v\nHINT: %s", c.name, err, c.hint)
+		}
+		if n := atomic.LoadInt32(&requests); n != c.expectedRequests {
+			t.Errorf("case %s: expected %d requests but got %d\nHINT: %s", c.name, c.expectedRequests, n, c.hint)
+		}
+	}
+}
+
+func TestFetcherRetryDeadline(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	f := newTestFetcher()
+	f.Retries = 5
+	f.RetryBackoff = time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := f.Fetch(ctx, server.URL)
+	if err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the 503 error, but got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected no retries when the backoff would pass the deadline, but there were %d requests", n)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected the request to fail without waiting, but it took %v", elapsed)
+	}
+}
+
+func TestFetcherBreaker(t *testing.T) {
+	var requests int32
+	var healthy int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>Page</title></head></html>"))
+	}))
+	defer server.Close()
+
+	f := newTestFetcher()
+	f.BreakerThreshold = 3
+	f.BreakerCooldown = 50 * time.Millisecond
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := f.Summarize(ctx, server.URL); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("request %d: expected the upstream error, but got %v", i, err)
+		}
+	}
+	if _, err := f.Summarize(ctx, server.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen after %d failures, but got %v", f.BreakerThreshold, err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("expected an open breaker to fail without a request, but there were %d requests", n)
+	}
+	breakers := f.Breakers()
+	if len(breakers) != 1 || breakers[0].State != BreakerOpen || breakers[0].Failures != 3 || breakers[0].OpenUntil == nil {
+		t.Errorf("expected one open breaker with 3 failures, but got %+v", breakers)
+	}
+
+	//a failed trial request reopens the breaker
+	time.Sleep(f.BreakerCooldown)
+	if _, err := f.Summarize(ctx, server.URL); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected a half-open breaker to let a trial request through, but got %v", err)
+	}
+	if _, err := f.Summarize(ctx, server.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected a failed trial request to reopen the breaker, but got %v", err)
+	}
+
+	//a successful trial request closes it
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(f.BreakerCooldown)
+	if breakers := f.Breakers(); len(breakers) != 1 || breakers[0].State != BreakerHalfOpen {
+		t.Errorf("expected the breaker to be half-open after the cooldown, but got %+v", breakers)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := f.Summarize(ctx, server.URL); err != nil {
+			t.Errorf("request %d: expected a successful trial request to close the breaker, but got %v", i, err)
+		}
+	}
+	if breakers := f.Breakers(); len(breakers) != 0 {
+		t.Errorf("expected no breakers to be reported once the host recovered, but got %+v", breakers)
+	}
+}
+
+func TestBreakerTrial(t *testing.T) {
+	f := newTestFetcher()
+	f.BreakerThreshold = 1
+	f.BreakerCooldown = 10 * time.Millisecond
+	req, _ := http.NewRequest("GET", "https://test.com/", nil)
+
+	//a request starts while the breaker is closed,
+	//then another fails and opens it
+	slow, err := f.breakerAllow(req)
+	if slow || err != nil {
+		t.Fatalf("expected a closed breaker to let a non-trial request through, but got %t, %v", slow, err)
+	}
+	failing, _ := f.breakerAllow(req)
+	failed := true
+	f.breakerDone(req, failing, &failed)
+
+	time.Sleep(f.BreakerCooldown)
+	if trial, err := f.breakerAllow(req); !trial || err != nil {
+		t.Fatalf("expected a half-open breaker to let a trial request through, but got %t, %v", trial, err)
+	}
+	//the first request finishing doesn't let another trial through
+	f.breakerDone(req, slow, nil)
+	if _, err := f.breakerAllow(req); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen while the trial request is in flight, but got %v", err)
+	}
+}
+
+func TestFetcherPrivateAddressNotRetried(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer server.Close()
+
+	f := NewFetcher()
+	f.Retries = 2
+	f.RetryBackoff = time.Second
+	f.BreakerThreshold = 2
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := f.Fetch(context.Background(), server.URL); !errors.Is(err, errPrivateAddress) {
+			t.Errorf("request %d: expected the private address to be rejected, but got %v", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected rejected requests not to be retried, but they took %v", elapsed)
+	}
+	if breakers := f.Breakers(); len(breakers) != 0 {
+		t.Errorf("expected rejected requests not to count against the breaker, but got %+v", breakers)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("expected no requests to reach the server, but got %d", n)
+	}
+}
+
+//timeoutError is a net.Error for a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransient(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	cases := []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		expected bool
+	}{
+		{"503", context.Background(), &statusError{http.StatusServiceUnavailable}, true},
+		{"404", context.Background(), &statusError{http.StatusNotFound}, false},
+		{"Wrapped 504", context.Background(), fmt.Errorf("fetching: %w", &statusError{http.StatusGatewayTimeout}), true},
+		{"Connection Reset", context.Background(), &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, true},
+		{"Unexpected EOF", context.Background(), io.ErrUnexpectedEOF, true},
+		{"Unknown Host", context.Background(), &net.DNSError{Err: "no such host", IsNotFound: true}, false},
+		{"Temporary DNS Failure", context.Background(), &net.DNSError{Err: "server misbehaving", IsTemporary: true}, true},
+		{"Wrapped Connection Reset", context.Background(), &url.Error{Op: "Get", URL: "https://test.com", Err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}}, true},
+		{"Timeout", context.Background(), &url.Error{Op: "Get", URL: "https://test.com", Err: timeoutError{}}, true},
+		{"Invalid Certificate", context.Background(), &url.Error{Op: "Get", URL: "https://test.com", Err: x509.UnknownAuthorityError{}}, false},
+		{"Too Many Redirects", context.Background(), &url.Error{Op: "Get", URL: "https://test.com", Err: errors.New("stopped after 10 redirects")}, false},
+		{"Cancelled", cancelled, &statusError{http.StatusServiceUnavailable}, false},
+		{"Private Address", context.Background(), errPrivateAddress, false},
+		{"Other", context.Background(), errors.New("page rejected"), false},
+	}
+	for _, c := range cases {
+		if actual := isTransient(c.ctx, c.err); actual != c.expected {
+			t.Errorf("case %s: expected isTransient to be %t but got %t", c.name, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package summary
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//DefaultCacheTTL is the default time a cached summary is fresh for.
+const DefaultCacheTTL = time.Hour
+
+//refreshTimeout limits how long refreshing a stale
+//summary in the background can take.
+const refreshTimeout = 30 * time.Second
+
+//CacheEntry is a page summary stored in a Cache,
+//or the failure to summarize a page.
+type CacheEntry struct {
+	//Summary is nil if the page couldn't be summarized.
+	Summary *PageSummary `json:"summary"`
+	//Error is why the page couldn't be summarized.
+	Error string `json:"error,omitempty"`
+	//ErrorKind is the kind of failure, one of the failure constants,
+	//so that an error of the same type can be returned for it.
+	ErrorKind string `json:"errorKind,omitempty"`
+	//ErrorStatus is the upstream response's status code,
+	//for failures of the FailureStatus kind.
+	ErrorStatus int `json:"errorStatus,omitempty"`
+	//Stored is when the summary was stored, or last revalidated.
+	Stored time.Time `json:"stored"`
+	//ETag and LastModified are the page's validators, from the
+	//upstream response's headers, which are used to revalidate
+	//the summary once it is no longer fresh.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+//Cache stores page summaries by URL. Implementations must be safe for
+//concurrent use, and must return copies, since callers may change
+//the summaries they get.
+type Cache interface {
+	//Get returns the entry for `key`, or nil if there is none.
+	Get(ctx context.Context, key string) (*CacheEntry, error)
+	//Set stores `entry` for `key`, replacing any previous entry.
+	Set(ctx context.Context, key string, entry *CacheEntry) error
+	//Delete removes the entry for `key`, if there is one.
+	Delete(ctx context.Context, key string) error
+}
+
+//The kinds of failures that are cached.
+const (
+	//FailureStatus is an error status code from the upstream server.
+	FailureStatus = "status"
+	//FailureTimeout is a timeout waiting for the upstream server.
+	FailureTimeout = "timeout"
+	//FailureNoHost is a host name that doesn't exist.
+	FailureNoHost = "no-host"
+	//FailureRejected is a page whose content type isn't supported.
+	FailureRejected = "rejected"
+)
+
+//cacheableFailure returns the kind of failure `err`, from summarizing
+//a page with `ctx`, is, if it is likely to happen again if the page is
+//fetched again soon. Otherwise it returns an empty string.
+func cacheableFailure(ctx context.Context, err error) string {
+	//timeouts waiting for the upstream server are cached, so that slow
+	//pages don't tie up requests for them, but not timeouts waiting on
+	//our own limits, or cancelled requests
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		var rt *roundTripError
+		if errors.As(err, &rt) {
+			return FailureTimeout
+		}
+		return ""
+	}
+	if ctx.Err() != nil {
+		return ""
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		if se.code >= 400 && se.code < 500 &&
+			se.code != http.StatusRequestTimeout && se.code != http.StatusTooManyRequests {
+			return FailureStatus
+		}
+		return ""
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return FailureNoHost
+		}
+		return ""
+	}
+	if errors.Is(err, errRejected) {
+		return FailureRejected
+	}
+	return ""
+}
+
+//failureEntry returns the cache entry for `err`, a failure of `kind`.
+func failureEntry(err error, kind string) *CacheEntry {
+	entry := &CacheEntry{Error: err.Error(), ErrorKind: kind, Stored: time.Now()}
+	var se *statusError
+	if errors.As(err, &se) {
+		entry.ErrorStatus = se.code
+	}
+	return entry
+}
+
+//cachedError is a failure read from the cache. It has the message of
+//the original error, and wraps an error of the same type.
+type cachedError struct {
+	msg string
+	err error
+}
+
+func (e *cachedError) Error() string { return e.msg }
+
+func (e *cachedError) Unwrap() error { return e.err }
+
+//cachedFailure returns the error for the cached failure `entry`.
+func cachedFailure(entry *CacheEntry) error {
+	var err error
+	switch entry.ErrorKind {
+	case FailureStatus:
+		err = &statusError{entry.ErrorStatus}
+	case FailureTimeout:
+		err = &roundTripError{context.DeadlineExceeded}
+	case FailureNoHost:
+		err = &net.DNSError{Err: "no such host", IsNotFound: true}
+	case FailureRejected:
+		err = errRejected
+	default:
+		return errors.New(entry.Error)
+	}
+	return &cachedError{msg: entry.Error, err: err}
+}
+
+//refreshes tracks the cached summaries being refreshed in the
+//background, so that each is only refreshed once at a time.
+type refreshes struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+//refresh summarizes `pageURL` again in the background, revalidating
+//the stale entry `cached`, and caches the result. Failures leave the
+//stale entry in the cache until it expires.
+func (f *Fetcher) refresh(ctx context.Context, pageURL string, opts *Options, cached *CacheEntry) {
+	rs := &f.refreshes
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.keys[pageURL] {
+		return
+	}
+	if rs.keys == nil {
+		rs.keys = map[string]bool{}
+	}
+	rs.keys[pageURL] = true
+
+	//the refresh outlives the request, but keeps its values,
+	//such as whether it is batch work
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+	go func() {
+		defer cancel()
+		if entry, err := f.summarize(ctx, pageURL, opts, cached); err == nil {
+			f.store(ctx, pageURL, entry)
+		}
+		rs.mu.Lock()
+		delete(rs.keys, pageURL)
+		rs.mu.Unlock()
+	}()
+}
+
+//MemoryCache is a Cache that keeps a limited number of entries in
+//memory, evicting the least recently used ones first.
+type MemoryCache struct {
+	maxEntries int
+	mu         sync.Mutex
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+//memoryItem is an element of a MemoryCache's order list.
+type memoryItem struct {
+	key string
+	//data is the JSON-encoded entry, so that callers
+	//can't change the stored summary
+	data []byte
+}
+
+//NewMemoryCache returns a MemoryCache that holds
+//at most `maxEntries` entries.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+//Get returns a copy of the entry for `key`, or nil if there is none.
+func (mc *MemoryCache) Get(ctx context.Context, key string) (*CacheEntry, error) {
+	mc.mu.Lock()
+	element, ok := mc.entries[key]
+	if !ok {
+		mc.mu.Unlock()
+		return nil, nil
+	}
+	mc.order.MoveToFront(element)
+	data := element.Value.(*memoryItem).data
+	mc.mu.Unlock()
+
+	entry := &CacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+//Set stores a copy of `entry` for `key`, evicting the least
+//recently used entry if the cache is full.
+func (mc *MemoryCache) Set(ctx context.Context, key string, entry *CacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if element, ok := mc.entries[key]; ok {
+		element.Value.(*memoryItem).data = data
+		mc.order.MoveToFront(element)
+		return nil
+	}
+	mc.entries[key] = mc.order.PushFront(&memoryItem{key, data})
+	for mc.maxEntries > 0 && mc.order.Len() > mc.maxEntries {
+		oldest := mc.order.Back()
+		mc.order.Remove(oldest)
+		delete(mc.entries, oldest.Value.(*memoryItem).key)
+	}
+	return nil
+}
+
+//Delete removes the entry for `key`, if there is one.
+func (mc *MemoryCache) Delete(ctx context.Context, key string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if element, ok := mc.entries[key]; ok {
+		mc.order.Remove(element)
+		delete(mc.entries, key)
+	}
+	return nil
+}
+
+//Len returns the number of entries in the cache.
+func (mc *MemoryCache) Len() int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.order.Len()
+}
+
+//CacheSize returns the number of entries in the cache and the total
+//size of their JSON encoding.
+func (mc *MemoryCache) CacheSize(ctx context.Context) (int, int64, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	var size int64
+	for element := mc.order.Front(); element != nil; element = element.Next() {
+		size += int64(len(element.Value.(*memoryItem).data))
+	}
+	return mc.order.Len(), size, nil
+}
+
+//ScanKeys calls `fn` with each key, from the most recently used,
+//until it returns false.
+func (mc *MemoryCache) ScanKeys(ctx context.Context, fn func(key string) bool) error {
+	mc.mu.Lock()
+	keys := make([]string, 0, mc.order.Len())
+	for element := mc.order.Front(); element != nil; element = element.Next() {
+		keys = append(keys, element.Value.(*memoryItem).key)
+	}
+	mc.mu.Unlock()
+	for _, key := range keys {
+		if !fn(key) {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package summary
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	mc := NewMemoryCache(2)
+	for _, key := range []string{"a", "b"} {
+		mc.Set(ctx, key, &CacheEntry{Summary: &PageSummary{Title: key}, Stored: time.Now()})
+	}
+	//using "a" makes "b" the least recently used
+	entry, err := mc.Get(ctx, "a")
+	if err != nil || entry == nil || entry.Summary.Title != "a" {
+		t.Fatalf("expected the entry for %q but got %+v, %v", "a", entry, err)
+	}
+	entry.Summary.Title = "changed"
+	mc.Set(ctx, "c", &CacheEntry{Summary: &PageSummary{Title: "c"}, Stored: time.Now()})
+
+	if entry, _ := mc.Get(ctx, "b"); entry != nil {
+		t.Errorf("expected the least recently used entry to be evicted")
+	}
+	if entry, _ := mc.Get(ctx, "a"); entry == nil || entry.Summary.Title != "a" {
+		t.Errorf("expected the cached entry to be unaffected by changes to a copy, but got %+v", entry)
+	}
+	mc.Delete(ctx, "a")
+	if entry, _ := mc.Get(ctx, "a"); entry != nil || mc.Len() != 1 {
+		t.Errorf("expected the deleted entry to be gone")
+	}
+}
+
+func TestFetcherCache(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Cached</title></head></html>`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	f := newTestFetcher()
+	f.Cache = NewMemoryCache(10)
+	f.CacheTTL = time.Minute
+	for i := 0; i < 2; i++ {
+		if s, err := f.Summarize(ctx, server.URL); err != nil || s.Title != "Cached" {
+			t.Fatalf("unexpected result %+v, %v", s, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected the second summary to come from the cache, but there were %d requests", requests)
+	}
+
+	opts := f.Options()
+	opts.Provenance = true
+	if s, err := f.SummarizeWith(ctx, server.URL, opts); err != nil || s.Provenance == nil {
+		t.Errorf("expected a summary with provenance but got %+v, %v", s, err)
+	}
+	if requests != 2 {
+		t.Errorf("expected summaries with provenance not to come from the cache")
+	}
+
+	f.Cache.Set(ctx, server.URL, &CacheEntry{Summary: &PageSummary{Title: "Stale"}, Stored: time.Now().Add(-time.Hour)})
+	if s, _ := f.Summarize(ctx, server.URL); s == nil || s.Title != "Cached" || requests != 3 {
+		t.Errorf("expected an expired entry to be fetched again, but got %+v after %d requests", s, requests)
+	}
+}
+
+func TestFetcherCacheRevalidation(t *testing.T) {
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	etag := `"v1"`
+	var fullResponses, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fullResponses++
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Page ` + etag + `</title></head></html>`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	f := newTestFetcher()
+	f.Cache = NewMemoryCache(10)
+	f.CacheTTL = time.Minute
+	if _, err := f.Summarize(ctx, server.URL); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	entry, _ := f.Cache.Get(ctx, server.URL)
+	if entry == nil || entry.ETag != etag || entry.LastModified != lastModified {
+		t.Fatalf("expected the entry to have the response's validators, but got %+v", entry)
+	}
+
+	//expire the entry, which should be revalidated rather than fetched again
+	entry.Stored = time.Now().Add(-time.Hour)
+	f.Cache.Set(ctx, server.URL, entry)
+	s, err := f.Summarize(ctx, server.URL)
+	if err != nil || s.Title != `Page "v1"` {
+		t.Errorf("expected the cached summary to be reused, but got %+v, %v", s, err)
+	}
+	if fullResponses != 1 || notModified != 1 {
+		t.Errorf("expected 1 full response and 1 not modified response, but got %d and %d", fullResponses, notModified)
+	}
+	if entry, _ := f.Cache.Get(ctx, server.URL); entry == nil || time.Since(entry.Stored) > time.Minute {
+		t.Errorf("expected revalidation to refresh the entry, but got %+v", entry)
+	}
+
+	//a changed page is fetched again
+	etag = `"v2"`
+	entry, _ = f.Cache.Get(ctx, server.URL)
+	entry.Stored = time.Now().Add(-time.Hour)
+	f.Cache.Set(ctx, server.URL, entry)
+	if s, err := f.Summarize(ctx, server.URL); err != nil || s.Title != `Page "v2"` {
+		t.Errorf("expected a changed page to be summarized again, but got %+v, %v", s, err)
+	}
+	if entry, _ := f.Cache.Get(ctx, server.URL); entry == nil || entry.ETag != etag {
+		t.Errorf("expected the entry to have the new ETag, but got %+v", entry)
+	}
+}
+
+func TestFetcherStaleWhileRevalidate(t *testing.T) {
+	var requests int32
+	var title atomic.Value
+	title.Store("First")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>` + title.Load().(string) + `</title></head></html>`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	f := newTestFetcher()
+	f.Cache = NewMemoryCache(10)
+	f.CacheTTL = time.Minute
+	f.StaleTTL = time.Minute
+	if _, err := f.Summarize(ctx, server.URL); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	//make the entry stale, within the grace window
+	title.Store("Second")
+	entry, _ := f.Cache.Get(ctx, server.URL)
+	entry.Stored = time.Now().Add(-90 * time.Second)
+	f.Cache.Set(ctx, server.URL, entry)
+	for i := 0; i < 3; i++ {
+		if s, err := f.Summarize(ctx, server.URL); err != nil || s.Title != "First" {
+			t.Errorf("expected the stale summary to be returned, but got %+v, %v", s, err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if entry, _ := f.Cache.Get(ctx, server.URL); entry != nil && entry.Summary.Title == "Second" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the stale summary to be refreshed in the background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected the stale summary to be refreshed once, but there were %d requests", n)
+	}
+
+	//past the grace window, the caller waits for a new summary
+	title.Store("Third")
+	entry, _ = f.Cache.Get(ctx, server.URL)
+	entry.Stored = time.Now().Add(-3 * time.Minute)
+	f.Cache.Set(ctx, server.URL, entry)
+	if s, err := f.Summarize(ctx, server.URL); err != nil || s.Title != "Third" {
+		t.Errorf("expected an expired summary to be fetched again, but got %+v, %v", s, err)
+	}
+}
+
+func TestFetcherErrorCache(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+		case "/request-timeout":
+			http.Error(w, "request timeout", http.StatusRequestTimeout)
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		name           string
+		hint           string
+		path           string
+		timeout        time.Duration
+		expectedCached bool
+	}{
+		{
+			"Not Found",
+			"404 responses should be cached",
+			"/missing",
+			time.Minute,
+			true,
+		},
+		{
+			"Unsupported Content",
+			"pages with unsupported content types should be cached",
+			"/json",
+			time.Minute,
+			true,
+		},
+		{
+			"Timeout",
+			"pages that time out should be cached",
+			"/slow",
+			20 * time.Millisecond,
+			true,
+		},
+		{
+			"Request Timeout",
+			"408 responses aren't about the page, so shouldn't be cached",
+			"/request-timeout",
+			time.Minute,
+			false,
+		},
+	}
+
+	for _, c := range cases {
+		f := newTestFetcher()
+		f.Cache = NewMemoryCache(10)
+		f.ErrorCacheTTL = time.Minute
+		atomic.StoreInt32(&requests, 0)
+		var errs []error
+		for i := 0; i < 2; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+			_, err := f.Summarize(ctx, server.URL+c.path)
+			cancel()
+			if err == nil {
+				t.Errorf("case %s: expected an error\nHINT: %s", c.name, c.hint)
+			}
+			errs = append(errs, err)
+		}
+		expectedRequests := int32(2)
+		if c.expectedCached {
+			expectedRequests = 1
+		}
+		if n := atomic.LoadInt32(&requests); n != expectedRequests {
+			t.Errorf("case %s: expected %d requests but got %d\nHINT: %s", c.name, expectedRequests, n, c.hint)
+		}
+		if c.expectedCached && errs[0] != nil && errs[1] != nil && errs[0].Error() != errs[1].Error() {
+			t.Errorf("case %s: expected the cached error %q but got %q\nHINT: %s", c.name, errs[0], errs[1], c.hint)
+		}
+		ctx := context.Background()
+		if c.expectedCached && cacheableFailure(ctx, errs[1]) != cacheableFailure(ctx, errs[0]) {
+			t.Errorf("case %s: expected the cached error to be the same kind of failure as %v, but got %v\nHINT: the type of the error should survive the cache", c.name, errs[0], errs[1])
+		}
+	}
+
+	var se *statusError
+	f := newTestFetcher()
+	f.Cache = NewMemoryCache(10)
+	f.ErrorCacheTTL = time.Minute
+	f.Summarize(context.Background(), server.URL+"/missing")
+	if _, err := f.Summarize(context.Background(), server.URL+"/missing"); !errors.As(err, &se) || se.code != http.StatusNotFound {
+		t.Errorf("expected the cached error to have the status code 404, but got %v", err)
+	}
+
+	//a timeout waiting for the host's limits isn't about the page
+	f = newTestFetcher()
+	f.Cache = NewMemoryCache(10)
+	f.ErrorCacheTTL = time.Minute
+	f.HostConcurrency = 1
+	req, _ := http.NewRequest("GET", server.URL+"/missing", nil)
+	release, err := f.acquireHost(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := f.Summarize(ctx, server.URL+"/limited"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the request to time out waiting for the host, but got %v", err)
+	}
+	release()
+	if entry, _ := f.Cache.Get(context.Background(), server.URL+"/limited"); entry != nil {
+		t.Errorf("expected a timeout waiting for the host's limits not to be cached, but got %+v", entry)
+	}
+}
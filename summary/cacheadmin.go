@@ -0,0 +1,128 @@
+package summary
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+//ErrCacheNotScannable is returned when purging by host from a Cache
+//that doesn't implement CacheScanner.
+var ErrCacheNotScannable = errors.New("the cache can't list its keys")
+
+//CacheScanner is implemented by Caches that can list their keys,
+//which allows purging entries by host.
+type CacheScanner interface {
+	//ScanKeys calls `fn` with each key, until it returns false.
+	//Keys added or removed during the scan may or may not be seen.
+	ScanKeys(ctx context.Context, fn func(key string) bool) error
+}
+
+//CacheSizer is implemented by Caches that can report their size.
+type CacheSizer interface {
+	//CacheSize returns the number of entries and their total size in bytes.
+	CacheSize(ctx context.Context) (entries int, bytes int64, err error)
+}
+
+//CacheStats describes a Fetcher's use of its Cache.
+type CacheStats struct {
+	//Entries and Bytes are the number and size of the entries, if
+	//the cache implements CacheSizer, or -1 if it doesn't.
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+	//Hits is the number of summaries, or failures,
+	//returned from the cache.
+	Hits int64 `json:"hits"`
+	//Misses is the number of pages fetched because
+	//they weren't cached, or had expired.
+	Misses int64 `json:"misses"`
+	//HitRatio is Hits over all lookups, or zero if there were none.
+	HitRatio float64 `json:"hitRatio"`
+}
+
+//cacheCounts counts a Fetcher's cache lookups.
+type cacheCounts struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+//CacheStats returns the number of entries in the fetcher's Cache,
+//their size, and how often lookups have found them since the fetcher
+//was created.
+func (f *Fetcher) CacheStats(ctx context.Context) (*CacheStats, error) {
+	stats := &CacheStats{
+		Entries: -1,
+		Bytes:   -1,
+		Hits:    f.cacheCounts.hits.Load(),
+		Misses:  f.cacheCounts.misses.Load(),
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+	if sizer, ok := f.Cache.(CacheSizer); ok {
+		var err error
+		if stats.Entries, stats.Bytes, err = sizer.CacheSize(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+//Refresh summarizes `pageURL` again and caches the new summary,
+//whether or not the cached one is fresh.
+func (f *Fetcher) Refresh(ctx context.Context, pageURL string) (*PageSummary, error) {
+	entry, err := f.summarize(ctx, pageURL, f.Options(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.Cache != nil {
+		f.store(ctx, pageURL, entry)
+	}
+	return entry.Summary, nil
+}
+
+//CheckHostPattern returns an error if `pattern` isn't a valid pattern
+//for PurgeHost.
+func CheckHostPattern(pattern string) error {
+	_, err := path.Match(pattern, "")
+	return err
+}
+
+//PurgeHost removes the cached summaries of the pages whose host
+//matches `pattern`, such as "example.com" or "*.example.com", where
+//* matches any part of the host name. It returns the number of
+//summaries removed. The Cache must implement CacheScanner.
+func (f *Fetcher) PurgeHost(ctx context.Context, pattern string) (int, error) {
+	if err := CheckHostPattern(pattern); err != nil {
+		return 0, err
+	}
+	scanner, ok := f.Cache.(CacheScanner)
+	if !ok {
+		return 0, ErrCacheNotScannable
+	}
+	pattern = strings.ToLower(pattern)
+	var keys []string
+	seen := map[string]bool{}
+	err := scanner.ScanKeys(ctx, func(key string) bool {
+		u, err := url.Parse(key)
+		if err == nil && !seen[key] {
+			if matched, _ := path.Match(pattern, strings.ToLower(u.Hostname())); matched {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i, key := range keys {
+		if err := f.Cache.Delete(ctx, key); err != nil {
+			return i, err
+		}
+	}
+	return len(keys), nil
+}
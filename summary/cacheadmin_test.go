@@ -0,0 +1,154 @@
+package summary
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+)
+
+//scanCache is a Cache that implements CacheScanner and CacheSizer.
+type scanCache interface {
+	Cache
+	CacheScanner
+	CacheSizer
+}
+
+func TestFetcherPurgeHost(t *testing.T) {
+	diskCache, err := NewDiskCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	caches := map[string]scanCache{
+		"Memory": NewMemoryCache(100),
+		"Disk":   diskCache,
+		"Redis":  NewRedisCache(newFakeRedis(t, "").listener.Addr().String()),
+	}
+	keys := []string{
+		"https://example.com/",
+		"https://www.example.com/page",
+		"https://a.b.example.com:8080/page",
+		"https://example.org/",
+		"https://notexample.com/",
+	}
+	cases := []struct {
+		name     string
+		hint     string
+		pattern  string
+		expected []string
+	}{
+		{
+			"Exact Host",
+			"a pattern without wildcards should only match that host",
+			"example.com",
+			[]string{"https://example.com/"},
+		},
+		{
+			"Subdomains",
+			"* should match any subdomain, ignoring the port",
+			"*.example.com",
+			[]string{"https://a.b.example.com:8080/page", "https://www.example.com/page"},
+		},
+		{
+			"Case",
+			"host patterns should be case-insensitive",
+			"EXAMPLE.ORG",
+			[]string{"https://example.org/"},
+		},
+		{
+			"No Match",
+			"a pattern matching no host should purge nothing",
+			"example.net",
+			nil,
+		},
+	}
+
+	ctx := context.Background()
+	for cacheName, cache := range caches {
+		f := newTestFetcher()
+		f.Cache = cache
+		for _, c := range cases {
+			for _, key := range keys {
+				cache.Set(ctx, key, &CacheEntry{Summary: &PageSummary{Title: key}, Stored: time.Now()})
+			}
+			purged, err := f.PurgeHost(ctx, c.pattern)
+			if err != nil {
+				t.Errorf("%s cache, case %s: unexpected error %v\nHINT: %s", cacheName, c.name, err, c.hint)
+				continue
+			}
+			var removed []string
+			for _, key := range keys {
+				if entry, _ := cache.Get(ctx, key); entry == nil {
+					removed = append(removed, key)
+				}
+			}
+			sort.Strings(removed)
+			if purged != len(c.expected) || len(removed) != len(c.expected) {
+				t.Errorf("%s cache, case %s: expected %v to be purged, but %d were purged: %v\nHINT: %s",
+					cacheName, c.name, c.expected, purged, removed, c.hint)
+				continue
+			}
+			for i := range removed {
+				if removed[i] != c.expected[i] {
+					t.Errorf("%s cache, case %s: expected %v to be purged, but got %v\nHINT: %s", cacheName, c.name, c.expected, removed, c.hint)
+					break
+				}
+			}
+		}
+		if entries, size, err := cache.CacheSize(ctx); err != nil || entries != len(keys) || size <= 0 {
+			t.Errorf("%s cache: expected %d entries of some size, but got %d of %d bytes, %v", cacheName, len(keys), entries, size, err)
+		}
+	}
+
+	f := newTestFetcher()
+	f.Cache = NewMemoryCache(10)
+	if _, err := f.PurgeHost(ctx, "[example.com"); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+	f.Cache = &unscannableCache{f.Cache}
+	if _, err := f.PurgeHost(ctx, "example.com"); !errors.Is(err, ErrCacheNotScannable) {
+		t.Errorf("expected ErrCacheNotScannable but got %v", err)
+	}
+}
+
+//unscannableCache hides the other methods of a Cache.
+type unscannableCache struct {
+	Cache
+}
+
+func TestFetcherCacheStats(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Page</title></head></html>`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	f := newTestFetcher()
+	f.Cache = NewMemoryCache(10)
+	for i := 0; i < 4; i++ {
+		f.Summarize(ctx, server.URL)
+	}
+	stats, err := f.CacheStats(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if stats.Hits != 3 || stats.Misses != 1 || stats.HitRatio != 0.75 || stats.Entries != 1 || stats.Bytes <= 0 {
+		t.Errorf("expected 3 hits, 1 miss and 1 entry, but got %+v", stats)
+	}
+
+	f.Cache = &unscannableCache{f.Cache}
+	if stats, _ := f.CacheStats(ctx); stats == nil || stats.Entries != -1 || stats.Bytes != -1 {
+		t.Errorf("expected unknown sizes for a cache that can't report them, but got %+v", stats)
+	}
+
+	//Refresh fetches the page even though its summary is fresh
+	if s, err := f.Refresh(ctx, server.URL); err != nil || s.Title != "Page" || requests != 2 {
+		t.Errorf("expected the page to be fetched again, but got %+v, %v after %d requests", s, err, requests)
+	}
+}
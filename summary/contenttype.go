@@ -0,0 +1,107 @@
+package summary
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+//ContentTypeMode controls how a Fetcher decides whether
+//a response is a web page it can summarize.
+type ContentTypeMode int
+
+const (
+	//LenientContentType accepts a response if either its declared
+	//Content-Type or its sniffed content looks like HTML or XHTML.
+	//This handles servers that send HTML as text/plain, as
+	//application/octet-stream, or without a Content-Type at all.
+	LenientContentType ContentTypeMode = iota
+	//StrictContentType accepts a response only if its declared
+	//Content-Type is text/html or application/xhtml+xml.
+	StrictContentType
+)
+
+//sniffLen is the number of bytes http.DetectContentType considers.
+const sniffLen = 512
+
+//htmlMediaTypes are the media types we treat as web pages.
+var htmlMediaTypes = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+}
+
+//ParseContentTypeMode parses the value of the CONTENT_TYPE_MODE
+//environment variable. An empty value means LenientContentType.
+func ParseContentTypeMode(s string) (ContentTypeMode, error) {
+	switch s {
+	case "", "lenient":
+		return LenientContentType, nil
+	case "strict":
+		return StrictContentType, nil
+	default:
+		return LenientContentType, fmt.Errorf("unknown content type mode %q: must be \"strict\" or \"lenient\"", s)
+	}
+}
+
+//readCloser pairs a reader, such as a buffered or limited
+//reader, with the closer of the stream it reads from.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+//sniffBody peeks at the first bytes of `body` and returns a stream
+//that still yields the full body, along with the sniffed media type.
+func sniffBody(body io.ReadCloser) (io.ReadCloser, string) {
+	buffered := bufio.NewReaderSize(body, sniffLen)
+	//a short body returns an error here, but we still get what was read
+	peeked, _ := buffered.Peek(sniffLen)
+	return &readCloser{buffered, body}, sniffContentType(peeked)
+}
+
+//sniffContentType returns the media type of `data` without parameters.
+//http.DetectContentType reports XHTML documents that start with an XML
+//declaration as text/xml, so those are reported as application/xhtml+xml.
+func sniffContentType(data []byte) string {
+	mediaType := mediaTypeOf(http.DetectContentType(data))
+	if mediaType == "text/xml" && bytes.Contains(bytes.ToLower(data), []byte("<html")) {
+		return "application/xhtml+xml"
+	}
+	return mediaType
+}
+
+//mediaTypeOf returns the lower-cased media type of a Content-Type
+//header value, or an empty string if it can't be parsed.
+func mediaTypeOf(ctype string) string {
+	mediaType, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+//isHTMLContent decides whether a response with the `declared` Content-Type
+//header and `sniffed` media type should be treated as a web page.
+//If not, the returned reason explains why it was rejected.
+func isHTMLContent(declared string, sniffed string, mode ContentTypeMode) (bool, string) {
+	declaredType := mediaTypeOf(declared)
+	if htmlMediaTypes[declaredType] {
+		return true, ""
+	}
+	if mode == StrictContentType {
+		if len(declared) == 0 {
+			return false, "no Content-Type was declared and strict content type checking is enabled"
+		}
+		return false, fmt.Sprintf("declared content type %q is not text/html or application/xhtml+xml and strict content type checking is enabled", declared)
+	}
+	if htmlMediaTypes[sniffed] {
+		return true, ""
+	}
+	if len(declared) == 0 {
+		return false, fmt.Sprintf("no Content-Type was declared and the content looks like %s, not HTML", sniffed)
+	}
+	return false, fmt.Sprintf("declared content type %q is not HTML and the content looks like %s, not HTML", declared, sniffed)
+}
@@ -0,0 +1,111 @@
+package summary
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchHTMLContentTypes(t *testing.T) {
+	const page = `<html><head><title>test</title></head><body></body></html>`
+	const xhtml = `<?xml version="1.0" encoding="UTF-8"?><html xmlns="http://www.w3.org/1999/xhtml"><head></head></html>`
+	const png = "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"
+	cases := []struct {
+		name        string
+		hint        string
+		ctype       string
+		body        string
+		mode        ContentTypeMode
+		expectError bool
+	}{
+		{
+			"HTML",
+			"text/html should always be accepted",
+			"text/html; charset=utf-8",
+			page,
+			StrictContentType,
+			false,
+		},
+		{
+			"XHTML",
+			"application/xhtml+xml is a web page too",
+			"application/xhtml+xml",
+			xhtml,
+			StrictContentType,
+			false,
+		},
+		{
+			"HTML as text/plain, lenient",
+			"lenient mode should sniff the content when the declared type is wrong",
+			"text/plain",
+			page,
+			LenientContentType,
+			false,
+		},
+		{
+			"HTML as text/plain, strict",
+			"strict mode should only trust the declared type",
+			"text/plain",
+			page,
+			StrictContentType,
+			true,
+		},
+		{
+			"No content type, lenient",
+			"lenient mode should sniff the content when no type is declared",
+			"",
+			page,
+			LenientContentType,
+			false,
+		},
+		{
+			"XHTML with no content type, lenient",
+			"XHTML starting with an XML declaration should be sniffed as XHTML",
+			"",
+			xhtml,
+			LenientContentType,
+			false,
+		},
+		{
+			"PNG, lenient",
+			"content that is neither declared nor sniffed as HTML should be rejected",
+			"image/png",
+			png,
+			LenientContentType,
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			//setting the header map entry directly prevents the server
+			//from sniffing and adding its own Content-Type
+			w.Header()["Content-Type"] = nil
+			if len(c.ctype) > 0 {
+				w.Header().Set("Content-Type", c.ctype)
+			}
+			w.Write([]byte(c.body))
+		}))
+
+		fetcher := newTestFetcher()
+		fetcher.ContentTypeMode = c.mode
+		stream, err := fetcher.FetchHTML(context.Background(), server.URL)
+		if err != nil && !c.expectError {
+			t.Errorf("case %s: unexpected error %v\nHINT: %s", c.name, err, c.hint)
+		}
+		if c.expectError && err == nil {
+			t.Errorf("case %s: expected error but didn't get one\nHINT: %s", c.name, c.hint)
+		}
+		if stream != nil {
+			summary, err := Extract(context.Background(), stream, server.URL, nil)
+			if err != nil {
+				t.Errorf("case %s: unexpected error extracting summary: %v", c.name, err)
+			} else if c.body == page && summary.Title != "test" {
+				t.Errorf("case %s: sniffed bytes were not replayed: expected title %q but got %q", c.name, "test", summary.Title)
+			}
+			stream.Close()
+		}
+		server.Close()
+	}
+}
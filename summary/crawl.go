@@ -0,0 +1,196 @@
+package summary
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//DefaultCrawlConcurrency is the default number of pages
+//a Crawler summarizes at once.
+const DefaultCrawlConcurrency = 4
+
+//DefaultCrawlDelay is the default least time between
+//a Crawler starting to fetch pages.
+const DefaultCrawlDelay = 250 * time.Millisecond
+
+//DefaultMaxCrawlPages is the default limit on the number
+//of pages a Crawler summarizes.
+const DefaultMaxCrawlPages = 50000
+
+//openGraphProperties are the Open Graph properties a page should have,
+//and the summary fields they fill.
+var openGraphProperties = []struct {
+	field    Field
+	property string
+}{
+	{FieldTitle, "og:title"},
+	{FieldType, "og:type"},
+	{FieldImages, "og:image"},
+	{FieldURL, "og:url"},
+	{FieldDescription, "og:description"},
+}
+
+//Crawler summarizes every page in a site's sitemaps, to pre-warm the
+//fetcher's cache, and reports pages with missing Open Graph meta-data.
+//It is meant for sites we own.
+type Crawler struct {
+	//Fetcher fetches the sitemaps and pages. The summaries are
+	//stored in its Cache, if it has one.
+	Fetcher *Fetcher
+	//Concurrency is how many pages are summarized at once.
+	//Zero means DefaultCrawlConcurrency.
+	Concurrency int
+	//Delay is the least time between starting to fetch pages.
+	//Zero means DefaultCrawlDelay.
+	Delay time.Duration
+	//MaxPages limits the number of pages summarized.
+	//Zero means DefaultMaxCrawlPages.
+	MaxPages int
+}
+
+//CrawlReport is the result of crawling a site.
+type CrawlReport struct {
+	Site string `json:"site"`
+	//Sitemaps are the sitemaps that were read.
+	Sitemaps []string `json:"sitemaps"`
+	//Pages is the number of pages summarized.
+	Pages int `json:"pages"`
+	//Errors are the sitemaps and pages that couldn't be read.
+	Errors []*CrawlError `json:"errors,omitempty"`
+	//MissingOpenGraph are the web pages missing some
+	//Open Graph properties.
+	MissingOpenGraph []*MissingOpenGraph `json:"missingOpenGraph,omitempty"`
+}
+
+//CrawlError is an error reading a sitemap or page.
+type CrawlError struct {
+	URL   string `json:"url,omitempty"`
+	Error string `json:"error"`
+}
+
+//MissingOpenGraph lists the Open Graph properties a page is missing.
+type MissingOpenGraph struct {
+	URL     string   `json:"url"`
+	Missing []string `json:"missing"`
+}
+
+//Crawl summarizes the pages in the sitemaps of the site at `siteURL`,
+//as found by Fetcher.SitemapURLs. The requests are batch work, as far
+//as the fetcher's Robots mode is concerned. If `ctx` is done, the pages
+//summarized so far are reported along with ctx.Err().
+func (c *Crawler) Crawl(ctx context.Context, siteURL string) (*CrawlReport, error) {
+	ctx = WithBatch(ctx)
+	maxPages := c.MaxPages
+	if maxPages <= 0 {
+		maxPages = DefaultMaxCrawlPages
+	}
+	report := &CrawlReport{Site: siteURL}
+	pages, sitemaps, errs := c.Fetcher.SitemapURLs(ctx, siteURL, maxPages)
+	report.Sitemaps = sitemaps
+	for _, err := range errs {
+		report.Errors = append(report.Errors, &CrawlError{Error: err.Error()})
+	}
+
+	concurrency := c.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultCrawlConcurrency
+	}
+	delay := c.Delay
+	if delay <= 0 {
+		delay = DefaultCrawlDelay
+	}
+	ticker := time.NewTicker(delay)
+	defer ticker.Stop()
+
+	todo := make(chan string)
+	go func() {
+		defer close(todo)
+		for _, page := range pages {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case todo <- page:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range todo {
+				summary, err := c.crawlPage(ctx, page)
+				mu.Lock()
+				if err != nil {
+					if ctx.Err() == nil {
+						report.Errors = append(report.Errors, &CrawlError{URL: page, Error: err.Error()})
+					}
+				} else {
+					report.Pages++
+					if missing := missingOpenGraph(summary); len(missing) > 0 {
+						report.MissingOpenGraph = append(report.MissingOpenGraph, &MissingOpenGraph{URL: page, Missing: missing})
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return report, ctx.Err()
+}
+
+//crawlPage summarizes `pageURL` with provenance, so its Open Graph
+//properties can be checked, and caches the summary.
+func (c *Crawler) crawlPage(ctx context.Context, pageURL string) (*PageSummary, error) {
+	opts := c.Fetcher.Options()
+	opts.Provenance = true
+	entry, err := c.Fetcher.summarize(ctx, pageURL, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Fetcher.Cache != nil {
+		c.Fetcher.store(ctx, pageURL, entry)
+	}
+	return entry.Summary, nil
+}
+
+//missingOpenGraph returns the Open Graph properties a web page's
+//summary is missing, going by its provenance. Other kinds of
+//documents, such as PDFs and images, don't have any.
+func missingOpenGraph(summary *PageSummary) []string {
+	if len(summary.ContentType) > 0 {
+		return nil
+	}
+	var missing []string
+	for _, og := range openGraphProperties {
+		if !fromOpenGraph(summary.Provenance[og.field]) {
+			missing = append(missing, og.property)
+		}
+	}
+	return missing
+}
+
+//fromOpenGraph reports whether the Open Graph extractor found a value
+//for a field, whether or not it was the one chosen.
+func fromOpenGraph(fp *FieldProvenance) bool {
+	if fp == nil {
+		return false
+	}
+	if fp.Source == "opengraph" {
+		return true
+	}
+	for _, alt := range fp.Alternatives {
+		if alt.Source == "opengraph" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package summary
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrawl(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow:\n# Sitemap: /commented.xml\nSitemap: " + server.URL + "/sitemap-index.xml\n"))
+		case "/sitemap-index.xml":
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+				<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+					<sitemap><loc>` + server.URL + `/sitemap-pages.xml.gz</loc></sitemap>
+					<sitemap><loc>https://elsewhere.test/sitemap.xml</loc></sitemap>
+				</sitemapindex>`))
+		case "/sitemap-pages.xml.gz":
+			buf := &bytes.Buffer{}
+			gz := gzip.NewWriter(buf)
+			gz.Write([]byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+				<url><loc>` + server.URL + `/complete</loc></url>
+				<url><loc>` + server.URL + `/partial</loc></url>
+				<url><loc>` + server.URL + `/missing</loc></url>
+				<url><loc>https://elsewhere.test/page</loc></url>
+				</urlset>`))
+			gz.Close()
+			w.Write(buf.Bytes())
+		case "/complete":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head>
+				<meta property="og:title" content="Complete">
+				<meta property="og:type" content="website">
+				<meta property="og:image" content="/a.png">
+				<meta property="og:url" content="/complete">
+				<meta property="og:description" content="All there">
+				</head></html>`))
+		case "/partial":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>Partial</title><meta property="og:type" content="article"></head></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	f := newTestFetcher()
+	f.Cache = NewMemoryCache(10)
+	crawler := &Crawler{Fetcher: f, Delay: time.Millisecond}
+	report, err := crawler.Crawl(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedSitemaps := []string{server.URL + "/sitemap-index.xml", server.URL + "/sitemap-pages.xml.gz"}
+	if !reflect.DeepEqual(report.Sitemaps, expectedSitemaps) {
+		t.Errorf("expected sitemaps %v but got %v", expectedSitemaps, report.Sitemaps)
+	}
+	if report.Pages != 2 {
+		t.Errorf("expected 2 pages to be summarized, since pages on other hosts are skipped, but got %d", report.Pages)
+	}
+	var errorURLs []string
+	for _, crawlErr := range report.Errors {
+		errorURLs = append(errorURLs, crawlErr.URL+" "+crawlErr.Error)
+	}
+	if len(errorURLs) != 2 || !strings.Contains(strings.Join(errorURLs, "\n"), server.URL+"/missing") ||
+		!strings.Contains(strings.Join(errorURLs, "\n"), "elsewhere.test/sitemap.xml") {
+		t.Errorf("expected errors for the missing page and the other host's sitemap, but got %q", errorURLs)
+	}
+	if len(report.MissingOpenGraph) != 1 {
+		t.Fatalf("expected one page to be missing Open Graph meta-data, but got %d", len(report.MissingOpenGraph))
+	}
+	missing := report.MissingOpenGraph[0]
+	sort.Strings(missing.Missing)
+	expectedMissing := []string{"og:description", "og:image", "og:title", "og:url"}
+	if missing.URL != server.URL+"/partial" || !reflect.DeepEqual(missing.Missing, expectedMissing) {
+		t.Errorf("expected %s to be missing %v, but got %s missing %v", server.URL+"/partial", expectedMissing, missing.URL, missing.Missing)
+	}
+
+	entry, _ := f.Cache.Get(context.Background(), server.URL+"/complete")
+	if entry == nil || entry.Summary.Title != "Complete" || entry.Summary.Provenance != nil {
+		t.Errorf("expected the crawled page to be cached without provenance, but got %+v", entry)
+	}
+}
+
+func TestSitemapURLsLarge(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sitemap.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		//sitemaps may be larger than the fetcher's MaxBytes
+		w.Write([]byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+			<url><loc>` + server.URL + `/first</loc></url>`))
+		w.Write(bytes.Repeat([]byte(" "), int(DefaultMaxBytes)+1))
+		w.Write([]byte(`<url><loc>` + server.URL + `/last</loc></url></urlset>`))
+	}))
+	defer server.Close()
+
+	f := newTestFetcher()
+	pages, _, errs := f.SitemapURLs(context.Background(), server.URL, 0)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if expected := []string{server.URL + "/first", server.URL + "/last"}; !reflect.DeepEqual(pages, expected) {
+		t.Errorf("expected pages %v but got %v", expected, pages)
+	}
+}
@@ -0,0 +1,317 @@
+package summary
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//diskEntrySuffix is the file name suffix of DiskCache entries.
+const diskEntrySuffix = ".json"
+
+//diskTempPrefix is the file name prefix of DiskCache entries being
+//written. Any left behind by a crash are removed by NewDiskCache.
+const diskTempPrefix = ".entry-"
+
+//DiskCache is a Cache that keeps each entry in a file in a directory,
+//so that entries survive restarts. It keeps an index of the files in
+//memory, and evicts the least recently used entries when their total
+//size is over a limit. Entries are written to a temporary file, which
+//is then renamed, so a crash never leaves a partially written entry.
+//The modification time of each file is the Stored time of its entry.
+type DiskCache struct {
+	dir      string
+	maxBytes int64
+	mu       sync.Mutex
+	size     int64
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+//diskItem is an element of a DiskCache's order list.
+type diskItem struct {
+	name   string
+	size   int64
+	stored time.Time
+	//key is empty for entries found on startup,
+	//until it is read from the file
+	key string
+}
+
+//diskEntry is the content of a DiskCache file. The key is kept
+//so that a hash collision is a miss rather than the wrong entry.
+type diskEntry struct {
+	Key   string      `json:"key"`
+	Entry *CacheEntry `json:"entry"`
+}
+
+//NewDiskCache returns a DiskCache that stores entries in `dir`, creating
+//it if needed, and holds at most `maxBytes` of them, or any amount if
+//`maxBytes` is zero. Entries already in `dir` are kept, and the least
+//recently stored are the first to be evicted.
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []os.FileInfo
+	for _, entry := range entries {
+		//files removed since the directory was read are skipped
+		if info, err := entry.Info(); err == nil {
+			files = append(files, info)
+		}
+	}
+	dc := &DiskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, file := range files {
+		name := file.Name()
+		switch {
+		case strings.HasPrefix(name, diskTempPrefix):
+			os.Remove(filepath.Join(dir, name))
+		case file.Mode().IsRegular() && strings.HasSuffix(name, diskEntrySuffix):
+			dc.entries[name] = dc.order.PushFront(&diskItem{name: name, size: file.Size(), stored: file.ModTime()})
+			dc.size += file.Size()
+		}
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if err := dc.evict(); err != nil {
+		return nil, err
+	}
+	return dc, nil
+}
+
+//diskFileName returns the name of the file for `key`.
+func diskFileName(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:]) + diskEntrySuffix
+}
+
+//Get returns the entry for `key`, or nil if there is none.
+func (dc *DiskCache) Get(ctx context.Context, key string) (*CacheEntry, error) {
+	name := diskFileName(key)
+	dc.mu.Lock()
+	element, ok := dc.entries[name]
+	if ok {
+		dc.order.MoveToFront(element)
+	}
+	dc.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dc.dir, name))
+	if os.IsNotExist(err) {
+		//it was evicted or deleted since the index was checked
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	de := &diskEntry{}
+	if err := json.Unmarshal(data, de); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if de.Key != key {
+		return nil, nil
+	}
+	return de.Entry, nil
+}
+
+//Set stores `entry` for `key`, evicting the least recently used
+//entries if the cache is over its size limit.
+func (dc *DiskCache) Set(ctx context.Context, key string, entry *CacheEntry) error {
+	data, err := json.Marshal(&diskEntry{key, entry})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dc.dir, diskTempPrefix)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		//so a crash just after the rename can't leave an empty file
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(tmp.Name(), entry.Stored, entry.Stored)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	name := diskFileName(key)
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	//rename with the lock held, so the index matches the files
+	if err := os.Rename(tmp.Name(), filepath.Join(dc.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	size := int64(len(data))
+	if element, ok := dc.entries[name]; ok {
+		item := element.Value.(*diskItem)
+		dc.size += size - item.size
+		item.size = size
+		item.stored = entry.Stored
+		item.key = key
+		dc.order.MoveToFront(element)
+	} else {
+		dc.entries[name] = dc.order.PushFront(&diskItem{name, size, entry.Stored, key})
+		dc.size += size
+	}
+	return dc.evict()
+}
+
+//Delete removes the entry for `key`, if there is one.
+func (dc *DiskCache) Delete(ctx context.Context, key string) error {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if element, ok := dc.entries[diskFileName(key)]; ok {
+		return dc.remove(element)
+	}
+	return nil
+}
+
+//remove deletes the file of `element` and removes it from the index.
+//The caller must hold dc.mu.
+func (dc *DiskCache) remove(element *list.Element) error {
+	item := element.Value.(*diskItem)
+	dc.order.Remove(element)
+	delete(dc.entries, item.name)
+	dc.size -= item.size
+	if err := os.Remove(filepath.Join(dc.dir, item.name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+//evict removes the least recently used entries until the cache
+//is within its size limit. The caller must hold dc.mu.
+func (dc *DiskCache) evict() error {
+	for dc.maxBytes > 0 && dc.size > dc.maxBytes {
+		if err := dc.remove(dc.order.Back()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Expire removes the entries stored more than `maxAge` ago.
+func (dc *DiskCache) Expire(maxAge time.Duration) error {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	cutoff := time.Now().Add(-maxAge)
+	for _, element := range dc.entries {
+		if element.Value.(*diskItem).stored.Before(cutoff) {
+			if err := dc.remove(element); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//ExpireEvery removes the entries stored more than `maxAge` ago every
+//`interval`, until `ctx` is done. Errors are passed to `onError`.
+func (dc *DiskCache) ExpireEvery(ctx context.Context, interval time.Duration, maxAge time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := dc.Expire(maxAge); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+//Len returns the number of entries in the cache.
+func (dc *DiskCache) Len() int {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.order.Len()
+}
+
+//Size returns the total size of the entries in the cache, in bytes.
+func (dc *DiskCache) Size() int64 {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.size
+}
+
+//CacheSize returns the number of entries in the cache and their total
+//size in bytes.
+func (dc *DiskCache) CacheSize(ctx context.Context) (int, int64, error) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.order.Len(), dc.size, nil
+}
+
+//ScanKeys calls `fn` with each key, until it returns false. The keys
+//of entries stored before the cache was created are read from their
+//files, so the first scan after a restart reads every entry.
+func (dc *DiskCache) ScanKeys(ctx context.Context, fn func(key string) bool) error {
+	dc.mu.Lock()
+	items := make([]diskItem, 0, dc.order.Len())
+	for element := dc.order.Front(); element != nil; element = element.Next() {
+		items = append(items, *element.Value.(*diskItem))
+	}
+	dc.mu.Unlock()
+
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		key := item.key
+		if len(key) == 0 {
+			data, err := os.ReadFile(filepath.Join(dc.dir, item.name))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			de := &diskEntry{}
+			if err := json.Unmarshal(data, de); err != nil {
+				//Get reports the corrupt entry, so just skip it
+				continue
+			}
+			key = de.Key
+			dc.mu.Lock()
+			if element, ok := dc.entries[item.name]; ok && len(element.Value.(*diskItem).key) == 0 {
+				element.Value.(*diskItem).key = key
+			}
+			dc.mu.Unlock()
+		}
+		if !fn(key) {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package summary
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskCache(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dc, err := NewDiskCache(dir, 0)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	stored := time.Now().Add(-time.Minute).Truncate(time.Second)
+	entry := &CacheEntry{Summary: &PageSummary{Title: "Page"}, Stored: stored, ETag: `"v1"`}
+	if err := dc.Set(ctx, "https://test.com/", entry); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	got, err := dc.Get(ctx, "https://test.com/")
+	if err != nil || got == nil || got.Summary.Title != "Page" || got.ETag != `"v1"` || !got.Stored.Equal(stored) {
+		t.Fatalf("expected the stored entry but got %+v, %v", got, err)
+	}
+	if got, err := dc.Get(ctx, "https://test.com/other"); got != nil || err != nil {
+		t.Errorf("expected a miss for a missing key but got %+v, %v", got, err)
+	}
+
+	//a crash may leave temporary files behind, which are cleaned up,
+	//while entries survive a restart
+	os.WriteFile(filepath.Join(dir, diskTempPrefix+"123"), []byte("{"), 0644)
+	dc, err = NewDiskCache(dir, 0)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, _ := dc.Get(ctx, "https://test.com/"); got == nil || got.Summary.Title != "Page" {
+		t.Errorf("expected the entry to survive a restart, but got %+v", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, diskTempPrefix+"123")); !os.IsNotExist(err) {
+		t.Errorf("expected temporary files to be removed, but got %v", err)
+	}
+	var keys []string
+	dc.ScanKeys(ctx, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 1 || keys[0] != "https://test.com/" {
+		t.Errorf("expected the keys of entries from before the restart to be read from their files, but got %v", keys)
+	}
+
+	if err := dc.Delete(ctx, "https://test.com/"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if got, _ := dc.Get(ctx, "https://test.com/"); got != nil || dc.Len() != 0 || dc.Size() != 0 {
+		t.Errorf("expected the entry to be deleted, but got %+v, with %d entries of %d bytes", got, dc.Len(), dc.Size())
+	}
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	//the same Stored time keeps the entries the same size
+	stored := time.Now().Truncate(time.Second)
+	probe, _ := NewDiskCache(t.TempDir(), 0)
+	probe.Set(ctx, "a", &CacheEntry{Summary: &PageSummary{Title: "a"}, Stored: stored})
+	entrySize := probe.Size()
+
+	//room for two entries
+	dc, err := NewDiskCache(dir, 2*entrySize)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, key := range []string{"a", "b"} {
+		dc.Set(ctx, key, &CacheEntry{Summary: &PageSummary{Title: key}, Stored: stored})
+	}
+	dc.Get(ctx, "a")
+	dc.Set(ctx, "c", &CacheEntry{Summary: &PageSummary{Title: "c"}, Stored: stored})
+	if got, _ := dc.Get(ctx, "b"); got != nil {
+		t.Errorf("expected the least recently used entry to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if got, _ := dc.Get(ctx, key); got == nil {
+			t.Errorf("expected %q to be kept", key)
+		}
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 2 {
+		t.Errorf("expected 2 files but got %d", len(files))
+	}
+
+	//a smaller limit evicts entries on startup
+	dc, err = NewDiskCache(dir, entrySize)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if dc.Len() != 1 {
+		t.Errorf("expected 1 entry after restarting with a smaller limit, but got %d", dc.Len())
+	}
+}
+
+func TestDiskCacheExpire(t *testing.T) {
+	ctx := context.Background()
+	dc, err := NewDiskCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	dc.Set(ctx, "old", &CacheEntry{Summary: &PageSummary{}, Stored: time.Now().Add(-2 * time.Hour)})
+	dc.Set(ctx, "new", &CacheEntry{Summary: &PageSummary{}, Stored: time.Now()})
+	if err := dc.Expire(time.Hour); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, _ := dc.Get(ctx, "old"); got != nil {
+		t.Errorf("expected the old entry to be expired")
+	}
+	if got, _ := dc.Get(ctx, "new"); got == nil {
+		t.Errorf("expected the new entry to be kept")
+	}
+}
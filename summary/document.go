@@ -0,0 +1,117 @@
+package summary
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+//Document is a parsed HTML document that extractors read from.
+type Document struct {
+	//Root is the document node returned by html.Parse.
+	Root *html.Node
+	//URL is the URL the document was fetched from,
+	//which relative URLs in the document are resolved against.
+	URL string
+	//ctx is the context of the summary the document is read for,
+	//which stops selectors matching once it is done.
+	ctx context.Context
+}
+
+//context returns the document's context, or the background
+//context if it doesn't have one.
+func (doc *Document) context() context.Context {
+	if doc.ctx == nil {
+		return context.Background()
+	}
+	return doc.ctx
+}
+
+//ResolveURL resolves `ref` against the document URL.
+//An empty reference stays empty rather than becoming the document URL.
+func (doc *Document) ResolveURL(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if len(ref) == 0 {
+		return ""
+	}
+	return getAbsoluteURL(doc.URL, ref)
+}
+
+//Elements returns the HTML elements with the given tag name in document
+//order. Elements in embedded SVG and MathML, such as an SVG <title>,
+//are not included.
+func (doc *Document) Elements(tag string) []*html.Node {
+	var elements []*html.Node
+	a := atom.Lookup([]byte(tag))
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && len(n.Namespace) == 0 &&
+			((a != 0 && n.DataAtom == a) || (a == 0 && n.Data == tag)) {
+			elements = append(elements, n)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc.Root)
+	return elements
+}
+
+//Attr returns the value of the attribute of `n` named `key`,
+//or an empty string if it has none.
+func Attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+//Text returns the text content of `n` and its descendants,
+//with runs of white space collapsed to single spaces.
+func Text(n *html.Node) string {
+	sb := &strings.Builder{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+//metaElement is the name and content of a <meta> element. The name is
+//from its `property` attribute, as Open Graph uses, or else its `name`.
+type metaElement struct {
+	Key     string
+	Content string
+	//Tag describes the element for provenance,
+	//for example `meta[property="og:title"]`.
+	Tag string
+}
+
+//metaElements returns the <meta> elements of `doc` that have a
+//property or name, in document order.
+func metaElements(doc *Document) []*metaElement {
+	var metas []*metaElement
+	for _, n := range doc.Elements("meta") {
+		for _, attr := range []string{"property", "name"} {
+			if key := Attr(n, attr); len(key) > 0 {
+				metas = append(metas, &metaElement{
+					Key:     key,
+					Content: Attr(n, "content"),
+					Tag:     `meta[` + attr + `="` + key + `"]`,
+				})
+				break
+			}
+		}
+	}
+	return metas
+}
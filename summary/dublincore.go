@@ -0,0 +1,45 @@
+package summary
+
+import "strings"
+
+//DublinCoreExtractor reads Dublin Core <meta name="DC.title"> and
+//<meta name="dcterms.title"> style elements, which are common on
+//library, government and academic sites.
+//See https://www.dublincore.org/specifications/dublin-core/dcmi-terms/.
+type DublinCoreExtractor struct{}
+
+//dublinCoreFields maps Dublin Core terms to the fields they set.
+var dublinCoreFields = map[string]Field{
+	"title":       FieldTitle,
+	"description": FieldDescription,
+	"abstract":    FieldDescription,
+	"creator":     FieldAuthor,
+	"publisher":   FieldSiteName,
+}
+
+//Name returns "dublincore".
+func (DublinCoreExtractor) Name() string { return "dublincore" }
+
+//Extract adds the Dublin Core terms of `doc` to `c`.
+func (DublinCoreExtractor) Extract(doc *Document, c *Candidates) {
+	for _, meta := range metaElements(doc) {
+		key := strings.ToLower(meta.Key)
+		var term string
+		switch {
+		case strings.HasPrefix(key, "dc."):
+			term = strings.TrimPrefix(key, "dc.")
+		case strings.HasPrefix(key, "dcterms."):
+			term = strings.TrimPrefix(key, "dcterms.")
+		default:
+			continue
+		}
+		if field, found := dublinCoreFields[term]; found {
+			c.Add(field, meta.Content, meta.Tag)
+		} else if term == "subject" {
+			//subjects are often one per element, but may also be a list
+			c.AddKeywords(strings.FieldsFunc(meta.Content, func(r rune) bool {
+				return r == ';' || r == ','
+			}), meta.Tag)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package summary
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+//Field names a PageSummary field that extractors can find values for.
+//The names match the field names in the JSON encoding of PageSummary.
+type Field string
+
+//The fields extractors can find values for.
+const (
+	FieldType        Field = "type"
+	FieldURL         Field = "url"
+	FieldTitle       Field = "title"
+	FieldSiteName    Field = "siteName"
+	FieldDescription Field = "description"
+	FieldAuthor      Field = "author"
+	FieldKeywords    Field = "keywords"
+	FieldIcon        Field = "icon"
+	FieldImages      Field = "images"
+)
+
+//Extractor finds values for summary fields in an HTML document.
+//
+//Extract runs every enabled extractor in its Registry's order, and each
+//one adds the values it finds to a shared set of Candidates. The summary
+//is then merged from the candidates with this precedence:
+//
+//  - Each field takes the first value found for it. Values from extractors
+//    earlier in the registry come first, and values from the same
+//    extractor are in document order.
+//  - Keywords and images are lists, which may be spread over several
+//    elements: they take every value found by the first extractor
+//    that found any.
+//
+//So with the default registry, Open Graph values override Twitter card
+//values, which override JSON-LD, Dublin Core and finally plain HTML.
+type Extractor interface {
+	//Name identifies the extractor in its Registry,
+	//and is recorded as the source of its candidates.
+	Name() string
+	//Extract adds the values it finds in `doc` to `c`.
+	Extract(doc *Document, c *Candidates)
+}
+
+//extractorFunc is an Extractor implemented by a function.
+type extractorFunc struct {
+	name string
+	fn   func(doc *Document, c *Candidates)
+}
+
+func (e *extractorFunc) Name() string                         { return e.name }
+func (e *extractorFunc) Extract(doc *Document, c *Candidates) { e.fn(doc, c) }
+
+//NewExtractor returns an Extractor with the given name that calls `fn`.
+//It is the easiest way to add a site-specific extractor.
+func NewExtractor(name string, fn func(doc *Document, c *Candidates)) Extractor {
+	return &extractorFunc{name, fn}
+}
+
+//Candidate is a value an extractor found for a field.
+//Depending on the field, its value is in Value, Keywords or Image.
+type Candidate struct {
+	Source   string        `json:"source"`
+	Tag      string        `json:"tag"`
+	Value    string        `json:"value,omitempty"`
+	Keywords []string      `json:"keywords,omitempty"`
+	Image    *PreviewImage `json:"image,omitempty"`
+}
+
+//Candidates collects the values extractors find for each field,
+//in order of precedence.
+type Candidates struct {
+	//source is the name of the extractor that is running
+	source string
+	fields map[Field][]*Candidate
+}
+
+//newCandidates returns an empty set of candidates.
+func newCandidates() *Candidates {
+	return &Candidates{fields: map[Field][]*Candidate{}}
+}
+
+//add records a candidate for `field` from the running extractor.
+func (c *Candidates) add(field Field, candidate *Candidate) {
+	candidate.Source = c.source
+	c.fields[field] = append(c.fields[field], candidate)
+}
+
+//Add adds a text value for `field`, found in the element described by
+//`tag`. Leading and trailing white space is trimmed, and empty values
+//are ignored.
+func (c *Candidates) Add(field Field, value string, tag string) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return
+	}
+	c.add(field, &Candidate{Tag: tag, Value: value})
+}
+
+//AddKeywords adds a list of keywords, found in the element described
+//by `tag`. Empty keywords are dropped, and an empty list is ignored.
+func (c *Candidates) AddKeywords(keywords []string, tag string) {
+	var values []string
+	for _, k := range keywords {
+		if k = strings.TrimSpace(k); len(k) > 0 {
+			values = append(values, k)
+		}
+	}
+	if len(values) == 0 {
+		return
+	}
+	c.add(FieldKeywords, &Candidate{Tag: tag, Keywords: values})
+}
+
+//AddImage adds an image for FieldIcon or FieldImages, found in the
+//element described by `tag`. Images without a URL are ignored. The
+//image may still be updated after it is added, for example when later
+//elements describe its size.
+func (c *Candidates) AddImage(field Field, img *PreviewImage, tag string) {
+	if len(img.URL) == 0 {
+		return
+	}
+	c.add(field, &Candidate{Tag: tag, Image: img})
+}
+
+//Get returns the candidates for `field` in order of precedence.
+func (c *Candidates) Get(field Field) []*Candidate {
+	return c.fields[field]
+}
+
+//Summary merges the candidates into a PageSummary,
+//following the precedence described on Extractor.
+func (c *Candidates) Summary() *PageSummary {
+	s := &PageSummary{}
+	for field, dst := range map[Field]*string{
+		FieldType:        &s.Type,
+		FieldURL:         &s.URL,
+		FieldTitle:       &s.Title,
+		FieldSiteName:    &s.SiteName,
+		FieldDescription: &s.Description,
+		FieldAuthor:      &s.Author,
+	} {
+		if candidates := c.fields[field]; len(candidates) > 0 {
+			*dst = candidates[0].Value
+		}
+	}
+	for _, candidate := range firstSource(c.fields[FieldKeywords]) {
+		s.Keywords = append(s.Keywords, candidate.Keywords...)
+	}
+	if candidates := c.fields[FieldIcon]; len(candidates) > 0 {
+		s.Icon = candidates[0].Image
+	}
+	for _, candidate := range firstSource(c.fields[FieldImages]) {
+		s.Images = append(s.Images, candidate.Image)
+	}
+	return s
+}
+
+//firstSource returns the candidates from the same source as the first.
+func firstSource(candidates []*Candidate) []*Candidate {
+	var first []*Candidate
+	for _, candidate := range candidates {
+		if candidate.Source == candidates[0].Source {
+			first = append(first, candidate)
+		}
+	}
+	return first
+}
+
+//Registry is an ordered list of extractors, each of which may be
+//enabled or disabled. The order sets their precedence, as described
+//on Extractor. A Registry is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	entries []*registryEntry
+}
+
+//registryEntry is an extractor in a Registry.
+type registryEntry struct {
+	extractor Extractor
+	disabled  bool
+}
+
+//NewRegistry returns a registry of the given extractors,
+//all enabled, in order of precedence.
+func NewRegistry(extractors ...Extractor) *Registry {
+	r := &Registry{}
+	for _, e := range extractors {
+		r.entries = append(r.entries, &registryEntry{extractor: e})
+	}
+	return r
+}
+
+//DefaultRegistry returns a new registry of the built-in extractors:
+//"opengraph", "twitter", "jsonld", "dublincore" and "html", in that order.
+func DefaultRegistry() *Registry {
+	return NewRegistry(
+		OpenGraphExtractor{},
+		TwitterExtractor{},
+		JSONLDExtractor{},
+		DublinCoreExtractor{},
+		HTMLExtractor{},
+	)
+}
+
+//defaultRegistry is used when no registry is given.
+var defaultRegistry = DefaultRegistry()
+
+//index returns the index of the extractor named `name`, or -1.
+//The caller must hold r.mu.
+func (r *Registry) index(name string) int {
+	for i, entry := range r.entries {
+		if entry.extractor.Name() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+//Register adds an enabled extractor with the lowest precedence.
+//An error is returned if an extractor with the same name is registered.
+func (r *Registry) Register(e Extractor) error {
+	return r.RegisterBefore("", e)
+}
+
+//RegisterBefore adds an enabled extractor with higher precedence than the
+//one named `name`, or with the lowest precedence if `name` is empty.
+//An error is returned if an extractor with the same name is registered,
+//or if no extractor is named `name`.
+func (r *Registry) RegisterBefore(name string, e Extractor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.index(e.Name()) >= 0 {
+		return fmt.Errorf("an extractor named %q is already registered", e.Name())
+	}
+	i := len(r.entries)
+	if len(name) > 0 {
+		if i = r.index(name); i < 0 {
+			return fmt.Errorf("unknown extractor %q", name)
+		}
+	}
+	r.entries = append(r.entries, nil)
+	copy(r.entries[i+1:], r.entries[i:])
+	r.entries[i] = &registryEntry{extractor: e}
+	return nil
+}
+
+//Enable enables the extractor named `name`.
+func (r *Registry) Enable(name string) error {
+	return r.setDisabled(name, false)
+}
+
+//Disable disables the extractor named `name`.
+func (r *Registry) Disable(name string) error {
+	return r.setDisabled(name, true)
+}
+
+func (r *Registry) setDisabled(name string, disabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.index(name)
+	if i < 0 {
+		return fmt.Errorf("unknown extractor %q", name)
+	}
+	r.entries[i].disabled = disabled
+	return nil
+}
+
+//Use enables exactly the named extractors, in the given order of
+//precedence, and disables the rest. Disabled extractors keep their
+//relative order after the enabled ones.
+func (r *Registry) Use(names ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var enabled []*registryEntry
+	for _, name := range names {
+		i := r.index(name)
+		if i < 0 {
+			return fmt.Errorf("unknown extractor %q", name)
+		}
+		for _, entry := range enabled {
+			if entry == r.entries[i] {
+				return fmt.Errorf("extractor %q is listed more than once", name)
+			}
+		}
+		enabled = append(enabled, r.entries[i])
+	}
+	var disabled []*registryEntry
+	for _, entry := range r.entries {
+		entry.disabled = true
+		for _, e := range enabled {
+			if e == entry {
+				entry.disabled = false
+			}
+		}
+		if entry.disabled {
+			disabled = append(disabled, entry)
+		}
+	}
+	r.entries = append(enabled, disabled...)
+	return nil
+}
+
+//Names returns the names of all registered extractors,
+//enabled or not, in order of precedence.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, len(r.entries))
+	for i, entry := range r.entries {
+		names[i] = entry.extractor.Name()
+	}
+	return names
+}
+
+//Extractors returns the enabled extractors in order of precedence.
+func (r *Registry) Extractors() []Extractor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var extractors []Extractor
+	for _, entry := range r.entries {
+		if !entry.disabled {
+			extractors = append(extractors, entry.extractor)
+		}
+	}
+	return extractors
+}
@@ -0,0 +1,238 @@
+package summary
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractors(t *testing.T) {
+	pagePrologue := "<html><head>"
+	pageEpilogue := "</head><body></body></html>"
+	pageURL := "http://test.com/articles/test.html"
+	cases := []struct {
+		name            string
+		hint            string
+		html            string
+		expectedSummary *PageSummary
+	}{
+		{
+			"Twitter Card",
+			"Twitter card properties should be used when there are no Open Graph properties",
+			pagePrologue + `
+			<meta name="twitter:title" content="twitter title">
+			<meta name="twitter:description" content="twitter description">
+			<meta name="twitter:image" content="/twitter.png">
+			<meta name="twitter:image:alt" content="twitter alt">
+			<title>HTML Title</title>` + pageEpilogue,
+			&PageSummary{
+				Title:       "twitter title",
+				Description: "twitter description",
+				Images: []*PreviewImage{
+					{URL: "http://test.com/twitter.png", Alt: "twitter alt"},
+				},
+			},
+		},
+		{
+			"Open Graph Over Twitter Card",
+			"Open Graph properties should take precedence over Twitter card properties, and images shouldn't be mixed",
+			pagePrologue + `
+			<meta name="twitter:title" content="twitter title">
+			<meta name="twitter:image" content="http://test.com/twitter.png">
+			<meta property="og:title" content="og title">
+			<meta property="og:image" content="http://test.com/og.png">` + pageEpilogue,
+			&PageSummary{
+				Title: "og title",
+				Images: []*PreviewImage{
+					{URL: "http://test.com/og.png"},
+				},
+			},
+		},
+		{
+			"JSON-LD",
+			"schema.org items in JSON-LD scripts should be read",
+			pagePrologue + `
+			<script type="application/ld+json">
+			{
+				"@context": "https://schema.org",
+				"@graph": [
+					{"@type": "WebSite", "name": "test site"},
+					{"@type": "Organization", "name": "test org"},
+					{
+						"@type": "NewsArticle",
+						"headline": "json-ld headline",
+						"description": "json-ld description",
+						"author": [{"@type": "Person", "name": "test author"}],
+						"keywords": ["one", "two"],
+						"image": {"@type": "ImageObject", "url": "/ld.png", "width": 1200, "height": 630}
+					}
+				]
+			}
+			</script>
+			<title>HTML Title</title>` + pageEpilogue,
+			&PageSummary{
+				Title:       "json-ld headline",
+				SiteName:    "test site",
+				Description: "json-ld description",
+				Author:      "test author",
+				Keywords:    []string{"one", "two"},
+				Images: []*PreviewImage{
+					{URL: "http://test.com/ld.png", Width: 1200, Height: 630},
+				},
+			},
+		},
+		{
+			"Invalid JSON-LD",
+			"scripts that aren't valid JSON should be skipped",
+			pagePrologue + `<script type="application/ld+json">{"headline": </script><title>HTML Title</title>` + pageEpilogue,
+			&PageSummary{
+				Title: "HTML Title",
+			},
+		},
+		{
+			"Dublin Core",
+			"Dublin Core terms should be read, with a subject per element",
+			pagePrologue + `
+			<meta name="DC.title" content="dc title">
+			<meta name="DC.creator" content="dc creator">
+			<meta name="dcterms.subject" content="one">
+			<meta name="dcterms.subject" content="two; three">
+			<meta name="keywords" content="html keywords">
+			<title>HTML Title</title>` + pageEpilogue,
+			&PageSummary{
+				Title:    "dc title",
+				Author:   "dc creator",
+				Keywords: []string{"one", "two", "three"},
+			},
+		},
+		{
+			"Canonical URL and Shortcut Icon",
+			`<link rel="canonical"> should set the URL and <link rel="shortcut icon"> is an icon`,
+			pagePrologue + `
+			<link rel="canonical" href="/articles/canonical.html">
+			<link rel="shortcut icon" href="/favicon.ico">` + pageEpilogue,
+			&PageSummary{
+				URL:  "http://test.com/articles/canonical.html",
+				Icon: &PreviewImage{URL: "http://test.com/favicon.ico"},
+			},
+		},
+		{
+			"SVG Title",
+			"<title> elements in SVG images are not the page title",
+			`<html><head></head><body><svg><title>icon</title></svg></body></html>`,
+			&PageSummary{},
+		},
+		{
+			"Structured Property Before Image",
+			"og:image:* properties before the first og:image should be ignored",
+			pagePrologue + `<meta property="og:image:width" content="100"><link rel="icon" href="/a.png" sizes="16">` + pageEpilogue,
+			&PageSummary{
+				Icon: &PreviewImage{URL: "http://test.com/a.png"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		summary, err := Extract(context.Background(), strings.NewReader(c.html), pageURL, nil)
+		if err != nil {
+			t.Errorf("case %s: unexpected error %v\nHINT: %s", c.name, err, c.hint)
+			continue
+		}
+		if !reflect.DeepEqual(summary, c.expectedSummary) {
+			expectedJSON, _ := json.MarshalIndent(c.expectedSummary, "", "  ")
+			actualJSON, _ := json.MarshalIndent(summary, "", "  ")
+			t.Errorf("case %s: incorrect result:\nEXPECTED: %s\nACTUAL: %s\nHINT: %s",
+				c.name, string(expectedJSON), string(actualJSON), c.hint)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	const page = `<html><head>
+		<meta property="og:title" content="og title">
+		<meta name="twitter:title" content="twitter title">
+		<title>HTML Title</title>
+		</head><body><h1>Heading</h1></body></html>`
+	heading := NewExtractor("heading", func(doc *Document, c *Candidates) {
+		if headings := doc.Elements("h1"); len(headings) > 0 {
+			c.Add(FieldTitle, Text(headings[0]), "h1")
+		}
+	})
+
+	cases := []struct {
+		name          string
+		hint          string
+		configure     func(r *Registry) error
+		expectedTitle string
+	}{
+		{
+			"Default Order",
+			"Open Graph should take precedence by default",
+			func(r *Registry) error { return nil },
+			"og title",
+		},
+		{
+			"Disable",
+			"disabled extractors should not contribute values",
+			func(r *Registry) error { return r.Disable("opengraph") },
+			"twitter title",
+		},
+		{
+			"Use",
+			"Use should enable only the named extractors, in the given order",
+			func(r *Registry) error { return r.Use("html", "opengraph") },
+			"HTML Title",
+		},
+		{
+			"Register",
+			"registered extractors should have the lowest precedence",
+			func(r *Registry) error {
+				if err := r.Register(heading); err != nil {
+					return err
+				}
+				return r.Use("heading", "html")
+			},
+			"Heading",
+		},
+		{
+			"Register Before",
+			"RegisterBefore should give the extractor higher precedence",
+			func(r *Registry) error { return r.RegisterBefore("opengraph", heading) },
+			"Heading",
+		},
+	}
+
+	for _, c := range cases {
+		registry := DefaultRegistry()
+		if err := c.configure(registry); err != nil {
+			t.Errorf("case %s: unexpected error configuring registry: %v", c.name, err)
+			continue
+		}
+		summary, err := Extract(context.Background(), strings.NewReader(page), "http://test.com", &Options{Registry: registry})
+		if err != nil {
+			t.Errorf("case %s: unexpected error %v", c.name, err)
+			continue
+		}
+		if summary.Title != c.expectedTitle {
+			t.Errorf("case %s: expected title %q but got %q\nHINT: %s", c.name, c.expectedTitle, summary.Title, c.hint)
+		}
+	}
+
+	registry := DefaultRegistry()
+	if err := registry.Disable("unknown"); err == nil {
+		t.Errorf("expected an error disabling an unknown extractor")
+	}
+	if err := registry.Register(OpenGraphExtractor{}); err == nil {
+		t.Errorf("expected an error registering an extractor twice")
+	}
+	if err := registry.Use("html", "html"); err == nil {
+		t.Errorf("expected an error using an extractor twice")
+	}
+	registry.Use("html", "twitter")
+	expectedNames := []string{"html", "twitter", "opengraph", "jsonld", "dublincore"}
+	if names := registry.Names(); !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("expected names %v but got %v", expectedNames, names)
+	}
+}
@@ -0,0 +1,422 @@
+package summary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//errRejected is returned for pages whose content type isn't supported.
+var errRejected = errors.New("page rejected")
+
+//Fetcher fetches pages from upstream servers and summarizes them.
+//Create Fetchers with NewFetcher, and set any fields before first use.
+//A Fetcher is safe for concurrent use.
+type Fetcher struct {
+	//ContentTypeMode controls which responses are treated as web pages.
+	ContentTypeMode ContentTypeMode
+	//MaxBytes is the most read from any response body. Longer bodies
+	//are truncated, which still leaves plenty of any web page to find
+	//its summary meta-data in the <head>. Zero means DefaultMaxBytes.
+	MaxBytes int64
+	//AllowPrivateAddresses allows fetching from loopback, private and
+	//other non-public addresses. It is off by default so that callers
+	//can't use a service to reach internal ones, and is only meant for
+	//local testing.
+	AllowPrivateAddresses bool
+	//UserAgent is sent as the User-Agent header of each request. Its
+	//product token, such as "SummaryBot" in "SummaryBot/1.0", is the
+	//agent robots.txt rules are matched against. Empty means
+	//DefaultUserAgent.
+	UserAgent string
+	//Robots controls when robots.txt is obeyed.
+	Robots RobotsMode
+	//HostRate limits the rate of requests to each host, in requests
+	//per second, with a token bucket. Zero means no limit.
+	HostRate float64
+	//HostBurst is the size of each host's token bucket, which is how
+	//many requests can be made at once after a quiet period.
+	//Zero means 1.
+	HostBurst int
+	//HostConcurrency limits the number of requests to each host that
+	//are active at once, until their bodies are closed. Zero means no
+	//limit. Requests over the limits wait their turn, unless their
+	//context's deadline would pass first, in which case they fail with
+	//ErrHostBusy. A host that responds with 429 Too Many Requests, or
+	//sends a Retry-After header, is paused for the time it asks for.
+	HostConcurrency int
+	//Retries is how many times a request is retried after a transient
+	//failure, such as a dropped connection or a 502, 503 or 504
+	//response. Zero means requests aren't retried. The delay before
+	//each retry doubles, starting from RetryBackoff, with some random
+	//jitter, and a retry isn't made if the delay would take it past
+	//the context's deadline.
+	Retries int
+	//RetryBackoff is the delay before the first retry.
+	//Zero means DefaultRetryBackoff.
+	RetryBackoff time.Duration
+	//BreakerThreshold is the number of consecutive transient failures
+	//of requests to a host that opens its circuit breaker. While it is
+	//open, requests to the host fail at once with ErrCircuitOpen. After
+	//BreakerCooldown, one trial request is let through, which closes
+	//the breaker if it succeeds, or reopens it if it fails.
+	//Zero means hosts have no circuit breakers.
+	BreakerThreshold int
+	//BreakerCooldown is how long a circuit breaker stays open.
+	//Zero means DefaultBreakerCooldown.
+	BreakerCooldown time.Duration
+	//Registry is the extractors used to summarize web pages.
+	//Nil means the extractors of DefaultRegistry.
+	Registry *Registry
+	//Cache stores the summaries of pages, so that they aren't fetched
+	//again while fresh. Nil means summaries aren't cached.
+	Cache Cache
+	//CacheTTL is how long cached summaries are fresh for.
+	//Zero means DefaultCacheTTL.
+	CacheTTL time.Duration
+	//StaleTTL is how long after a cached summary stops being fresh that
+	//it is still returned, while it is refreshed in the background.
+	//Zero means stale summaries are never returned.
+	StaleTTL time.Duration
+	//ErrorCacheTTL is how long failures to summarize a page are cached,
+	//so that repeated requests for a bad link fail without fetching it
+	//again. The failures cached are 4xx responses other than 408 and
+	//429, unsupported content types, unknown hosts and timeouts.
+	//Zero means failures aren't cached.
+	ErrorCacheTTL time.Duration
+	//Client sends the requests. The client NewFetcher creates refuses
+	//to connect to non-public addresses unless AllowPrivateAddresses is
+	//set, limits redirects, and doesn't use a proxy.
+	Client *http.Client
+
+	robotsCache robotsCache
+	hostLimits  hostLimits
+	refreshes   refreshes
+	cacheCounts cacheCounts
+}
+
+//NewFetcher returns a Fetcher with the default settings.
+func NewFetcher() *Fetcher {
+	f := &Fetcher{}
+	f.Client = newUpstreamClient(func() bool { return f.AllowPrivateAddresses })
+	return f
+}
+
+//Page is a successful response to a GET request
+//whose body has been sniffed to determine its content type.
+type Page struct {
+	Body          io.ReadCloser
+	StatusCode    int
+	Header        http.Header
+	ContentType   string
+	Sniffed       string
+	ContentLength int64
+}
+
+//MediaType returns the image, audio or video media type of the page,
+//or an empty string if it is none of those. The sniffed type is
+//preferred since servers often declare a generic or wrong Content-Type.
+func (page *Page) MediaType() string {
+	for _, mediaType := range []string{page.Sniffed, mediaTypeOf(page.ContentType)} {
+		if strings.HasPrefix(mediaType, "image/") ||
+			strings.HasPrefix(mediaType, "audio/") ||
+			strings.HasPrefix(mediaType, "video/") {
+			return mediaType
+		}
+	}
+	return ""
+}
+
+//maxBytes returns the effective MaxBytes of the fetcher.
+func (f *Fetcher) maxBytes() int64 {
+	return (&Options{MaxBytes: f.MaxBytes}).maxBytes()
+}
+
+//Fetch does an HTTP GET for `pageURL` and sniffs the response body,
+//which is limited to MaxBytes. An error is returned if the URL isn't
+//an http or https URL, if it resolves to a non-public address, if the
+//site's robots.txt disallows it and the Robots mode applies, if the
+//host's circuit breaker is open, or if the response status code is an
+//error (>=400), after any retries. The caller must close the page's Body.
+func (f *Fetcher) Fetch(ctx context.Context, pageURL string) (*Page, error) {
+	return f.FetchRange(ctx, pageURL, "")
+}
+
+//FetchRange is like Fetch, but if `byteRange` is not empty, it asks for
+//just those bytes (e.g. "0-1023") with a Range request. Servers may
+//ignore the Range header and send the whole body, so callers should
+//check the status code or limit how much they read.
+func (f *Fetcher) FetchRange(ctx context.Context, pageURL string, byteRange string) (*Page, error) {
+	header := http.Header{}
+	if len(byteRange) > 0 {
+		header.Set("Range", "bytes="+byteRange)
+	}
+	return f.fetch(ctx, pageURL, header, f.maxBytes())
+}
+
+//fetch is like Fetch, but adds `header` to the request, and limits the
+//page's Body to `maxBytes` rather than MaxBytes.
+func (f *Fetcher) fetch(ctx context.Context, pageURL string, header http.Header, maxBytes int64) (*Page, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	if err := checkUpstreamURL(req.URL); err != nil {
+		return nil, err
+	}
+	if err := f.checkRobots(ctx, req.URL); err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("User-Agent", f.userAgent())
+
+	//retry transient failures with backoff, as long as
+	//there is time left before the context's deadline
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		page, err := f.fetchOnce(ctx, req, maxBytes)
+		if attempt > 0 && errors.Is(err, ErrHostBusy) {
+			//a retry that can't start in time, such as when the host
+			//asked us to wait, fails with the error it was retrying
+			return nil, lastErr
+		}
+		if err == nil || attempt >= f.Retries || !isTransient(ctx, err) {
+			return page, err
+		}
+		lastErr = err
+		backoff := f.retryBackoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return nil, err
+		}
+		if sleepContext(ctx, backoff) != nil {
+			return nil, err
+		}
+	}
+}
+
+//fetchOnce makes one attempt at the GET request `req`, under the
+//limits and circuit breaker of its host. The page's Body is limited
+//to `maxBytes`.
+func (f *Fetcher) fetchOnce(ctx context.Context, req *http.Request, maxBytes int64) (*Page, error) {
+	trial, err := f.breakerAllow(req)
+	if err != nil {
+		return nil, err
+	}
+	release, err := f.acquireHost(ctx, req)
+	if err != nil {
+		f.breakerDone(req, trial, nil)
+		return nil, err
+	}
+	resp, err := f.Client.Do(req.Clone(ctx))
+	if err != nil {
+		err = &roundTripError{err}
+	}
+	if err == nil && resp.StatusCode >= 400 {
+		resp.Body.Close()
+		err = &statusError{resp.StatusCode}
+	}
+	if err != nil {
+		release()
+		failed := isTransient(ctx, err)
+		if ctx.Err() != nil {
+			f.breakerDone(req, trial, nil)
+		} else {
+			f.breakerDone(req, trial, &failed)
+		}
+		if resp != nil {
+			if d := retryAfter(resp, time.Now()); d > 0 {
+				f.pauseHost(req, d)
+			}
+		}
+		return nil, err
+	}
+	failed := false
+	f.breakerDone(req, trial, &failed)
+
+	body, sniffed := sniffBody(&readCloser{
+		Reader: io.LimitReader(resp.Body, maxBytes),
+		Closer: &releaseCloser{Closer: resp.Body, release: release},
+	})
+	return &Page{
+		Body:          body,
+		StatusCode:    resp.StatusCode,
+		Header:        resp.Header,
+		ContentType:   resp.Header.Get("Content-Type"),
+		Sniffed:       sniffed,
+		ContentLength: resp.ContentLength,
+	}, nil
+}
+
+//FetchHTML fetches `pageURL` and returns the body stream or an error.
+//Errors are returned if the response status code is an error (>=400),
+//or if the content type indicates the URL is not an HTML page.
+func (f *Fetcher) FetchHTML(ctx context.Context, pageURL string) (io.ReadCloser, error) {
+	page, err := f.Fetch(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok, reason := isHTMLContent(page.ContentType, page.Sniffed, f.ContentTypeMode); !ok {
+		page.Body.Close()
+		return nil, fmt.Errorf("%w: %s", errRejected, reason)
+	}
+
+	return page.Body, nil
+}
+
+//Options returns the options the fetcher extracts web pages with.
+func (f *Fetcher) Options() *Options {
+	return &Options{MaxBytes: f.MaxBytes, Registry: f.Registry}
+}
+
+//Summarize fetches `pageURL` and summarizes it according to its content
+//type. Web pages are parsed by Extract, while direct links to PDFs,
+//images, audio and video are summarized from the file itself.
+func (f *Fetcher) Summarize(ctx context.Context, pageURL string) (*PageSummary, error) {
+	return f.SummarizeWith(ctx, pageURL, f.Options())
+}
+
+//SummarizeWith is like Summarize, but extracts web pages with `opts`,
+//which callers normally get from Options and then adjust. If the
+//fetcher has a Cache, a fresh cached summary is returned if there is
+//one, and new summaries are cached. A stale summary, within StaleTTL
+//of expiring, is returned while it is refreshed in the background. An
+//older one is revalidated with the upstream server, using the ETag and
+//Last-Modified headers it was stored with, and is reused if the page
+//hasn't changed. Failures are cached for ErrorCacheTTL. Summaries with
+//provenance or query values aren't cached.
+func (f *Fetcher) SummarizeWith(ctx context.Context, pageURL string, opts *Options) (*PageSummary, error) {
+	cacheable := f.Cache != nil && opts.cacheable()
+	var cached *CacheEntry
+	if cacheable {
+		//errors from the cache are treated as misses,
+		//since the page can still be fetched
+		entry, err := f.Cache.Get(ctx, pageURL)
+		if err == nil && entry != nil {
+			age := time.Since(entry.Stored)
+			switch {
+			case entry.Summary == nil:
+				if age < f.ErrorCacheTTL {
+					f.cacheCounts.hits.Add(1)
+					return nil, cachedFailure(entry)
+				}
+			case age < f.cacheTTL():
+				f.cacheCounts.hits.Add(1)
+				return entry.Summary, nil
+			case age < f.cacheTTL()+f.StaleTTL:
+				f.cacheCounts.hits.Add(1)
+				f.refresh(ctx, pageURL, opts, entry)
+				return entry.Summary, nil
+			default:
+				cached = entry
+			}
+		}
+		f.cacheCounts.misses.Add(1)
+	}
+	entry, err := f.summarize(ctx, pageURL, opts, cached)
+	if err != nil {
+		if kind := cacheableFailure(ctx, err); cacheable && f.ErrorCacheTTL > 0 && len(kind) > 0 {
+			//the request's context may be done, if it timed out
+			f.Cache.Set(context.WithoutCancel(ctx), pageURL, failureEntry(err, kind))
+		}
+		return nil, err
+	}
+	if cacheable {
+		f.store(ctx, pageURL, entry)
+	}
+	return entry.Summary, nil
+}
+
+//store caches `entry` for `pageURL`, without any provenance or query
+//values. Errors are ignored, since the summary can be fetched again.
+func (f *Fetcher) store(ctx context.Context, pageURL string, entry *CacheEntry) {
+	stored := *entry
+	summary := *entry.Summary
+	summary.Provenance = nil
+	summary.Values = nil
+	stored.Summary = &summary
+	f.Cache.Set(ctx, pageURL, &stored)
+}
+
+//cacheTTL returns the effective CacheTTL of the fetcher.
+func (f *Fetcher) cacheTTL() time.Duration {
+	if f.CacheTTL <= 0 {
+		return DefaultCacheTTL
+	}
+	return f.CacheTTL
+}
+
+//summarize fetches `pageURL` and summarizes it, returning a new cache
+//entry for the summary. If `cached` isn't nil, the request is made
+//conditional on the page having changed since it was cached, and if
+//it hasn't, `cached` is returned with its Stored time refreshed.
+func (f *Fetcher) summarize(ctx context.Context, pageURL string, opts *Options, cached *CacheEntry) (*CacheEntry, error) {
+	header := http.Header{}
+	if cached != nil {
+		if len(cached.ETag) > 0 {
+			header.Set("If-None-Match", cached.ETag)
+		}
+		if len(cached.LastModified) > 0 {
+			header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	page, err := f.fetch(ctx, pageURL, header, f.maxBytes())
+	if err != nil {
+		return nil, err
+	}
+	defer page.Body.Close()
+
+	if page.StatusCode == http.StatusNotModified {
+		if len(header) == 0 {
+			return nil, &statusError{page.StatusCode}
+		}
+		entry := *cached
+		entry.Stored = time.Now()
+		//a 304 response may update the validators
+		if etag := page.Header.Get("ETag"); len(etag) > 0 {
+			entry.ETag = etag
+		}
+		if lastModified := page.Header.Get("Last-Modified"); len(lastModified) > 0 {
+			entry.LastModified = lastModified
+		}
+		return &entry, nil
+	}
+	summary, err := f.summarizePage(ctx, pageURL, opts, page)
+	if err != nil {
+		return nil, err
+	}
+	return &CacheEntry{
+		Summary:      summary,
+		Stored:       time.Now(),
+		ETag:         page.Header.Get("ETag"),
+		LastModified: page.Header.Get("Last-Modified"),
+	}, nil
+}
+
+//summarizePage summarizes `page` according to its content type.
+func (f *Fetcher) summarizePage(ctx context.Context, pageURL string, opts *Options, page *Page) (*PageSummary, error) {
+
+	ok, reason := isHTMLContent(page.ContentType, page.Sniffed, f.ContentTypeMode)
+	if ok {
+		return Extract(ctx, page.Body, pageURL, opts)
+	}
+
+	if page.Sniffed == "application/pdf" || mediaTypeOf(page.ContentType) == "application/pdf" {
+		return f.extractPDFSummary(ctx, pageURL, page)
+	}
+
+	mediaType := page.MediaType()
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return extractImageSummary(pageURL, mediaType, page)
+	case strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "video/"):
+		return extractMediaSummary(pageURL, mediaType, page), nil
+	}
+	return nil, fmt.Errorf("%w: %s", errRejected, reason)
+}
@@ -0,0 +1,228 @@
+package summary
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//ErrHostBusy is returned when a request can't start before its
+//context's deadline, because of the fetcher's limits on requests
+//to the host, or because the host asked us to slow down.
+var ErrHostBusy = errors.New("too many requests to the host")
+
+//defaultRetryAfter is how long a host is paused after it responds
+//with 429 Too Many Requests without a Retry-After header.
+const defaultRetryAfter = 5 * time.Second
+
+//maxRetryAfter limits how long a Retry-After header can pause a host.
+const maxRetryAfter = 5 * time.Minute
+
+//maxTrackedHosts is the number of hosts tracked before idle ones
+//are forgotten.
+const maxTrackedHosts = 10000
+
+//hostLimits tracks the requests to each host,
+//to enforce a Fetcher's per-host limits.
+type hostLimits struct {
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+//hostState is the state of requests to one host.
+type hostState struct {
+	//slots has an element for each active request,
+	//or is nil if concurrency isn't limited
+	slots chan struct{}
+	//tokens is the token bucket's level at `updated`
+	tokens  float64
+	updated time.Time
+	//pausedUntil is when the host said we could make requests again
+	pausedUntil time.Time
+	//failures is the number of consecutive transient failures,
+	//for the circuit breaker
+	failures int
+	//openedAt is when the circuit breaker last opened
+	openedAt time.Time
+	//trial is set while a half-open breaker's trial request is in flight
+	trial bool
+	//users is the number of requests waiting for or holding the host's
+	//limits, which keeps the state from being forgotten while they use it
+	users int
+}
+
+//hostKey returns the key of the host of `req`.
+func hostKey(req *http.Request) string {
+	return strings.ToLower(req.URL.Host)
+}
+
+//hostBurst returns the effective HostBurst of the fetcher.
+func (f *Fetcher) hostBurst() float64 {
+	if f.HostBurst <= 0 {
+		return 1
+	}
+	return float64(f.HostBurst)
+}
+
+//host returns the state of `key`, creating it if needed.
+//The caller must hold hl.mu.
+func (f *Fetcher) host(key string, now time.Time) *hostState {
+	hl := &f.hostLimits
+	if hl.hosts == nil {
+		hl.hosts = map[string]*hostState{}
+	}
+	state := hl.hosts[key]
+	if state != nil {
+		return state
+	}
+	if len(hl.hosts) >= maxTrackedHosts {
+		for k, s := range hl.hosts {
+			if s.idle(now, f.HostRate, f.hostBurst()) {
+				delete(hl.hosts, k)
+			}
+		}
+	}
+	state = &hostState{tokens: f.hostBurst(), updated: now}
+	if f.HostConcurrency > 0 {
+		state.slots = make(chan struct{}, f.HostConcurrency)
+	}
+	hl.hosts[key] = state
+	return state
+}
+
+//idle reports whether forgetting the state would make no difference.
+func (s *hostState) idle(now time.Time, rate float64, burst float64) bool {
+	return s.users == 0 && len(s.slots) == 0 && !now.Before(s.pausedUntil) && s.failures == 0 && !s.trial &&
+		(rate <= 0 || s.tokens+now.Sub(s.updated).Seconds()*rate >= burst)
+}
+
+//acquireHost waits until a request to the host of `req` may start, going
+//by the fetcher's per-host limits and any pause the host asked for, and
+//returns a function to call when the request is finished. If `ctx` has
+//a deadline that would pass before the request could start, it returns
+//ErrHostBusy without waiting.
+func (f *Fetcher) acquireHost(ctx context.Context, req *http.Request) (func(), error) {
+	key := hostKey(req)
+	f.hostLimits.mu.Lock()
+	state := f.host(key, time.Now())
+	state.users++
+	f.hostLimits.mu.Unlock()
+	done := func() {
+		f.hostLimits.mu.Lock()
+		state.users--
+		f.hostLimits.mu.Unlock()
+	}
+
+	release := done
+	if state.slots != nil {
+		select {
+		case state.slots <- struct{}{}:
+		case <-ctx.Done():
+			done()
+			return nil, ctx.Err()
+		}
+		release = func() {
+			<-state.slots
+			done()
+		}
+	}
+
+	//reserve a token, then wait until it is available
+	f.hostLimits.mu.Lock()
+	now := time.Now()
+	var wait time.Duration
+	if f.HostRate > 0 {
+		state.tokens += now.Sub(state.updated).Seconds() * f.HostRate
+		if burst := f.hostBurst(); state.tokens > burst {
+			state.tokens = burst
+		}
+		state.updated = now
+		state.tokens--
+		if state.tokens < 0 {
+			wait = time.Duration(-state.tokens / f.HostRate * float64(time.Second))
+		}
+	}
+	if paused := state.pausedUntil.Sub(now); paused > wait {
+		wait = paused
+	}
+	f.hostLimits.mu.Unlock()
+	unreserve := func() {
+		f.hostLimits.mu.Lock()
+		if f.HostRate > 0 {
+			state.tokens++
+		}
+		f.hostLimits.mu.Unlock()
+		release()
+	}
+
+	if wait <= 0 {
+		return release, nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		unreserve()
+		return nil, ErrHostBusy
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return release, nil
+	case <-ctx.Done():
+		unreserve()
+		return nil, ctx.Err()
+	}
+}
+
+//pauseHost stops requests to the host of `req` from starting
+//for `d`, unless it is already paused for longer.
+func (f *Fetcher) pauseHost(req *http.Request, d time.Duration) {
+	f.hostLimits.mu.Lock()
+	defer f.hostLimits.mu.Unlock()
+	now := time.Now()
+	state := f.host(hostKey(req), now)
+	if until := now.Add(d); until.After(state.pausedUntil) {
+		state.pausedUntil = until
+	}
+}
+
+//retryAfter returns how long a 429 or 503 response asks us to wait
+//before making more requests, or zero for other responses. 503
+//responses only ask us to wait if they have a Retry-After header.
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+	var d time.Duration
+	header := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if seconds, err := strconv.Atoi(header); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		d = date.Sub(now)
+	} else if resp.StatusCode == http.StatusTooManyRequests {
+		d = defaultRetryAfter
+	}
+	if d > maxRetryAfter {
+		d = maxRetryAfter
+	}
+	return d
+}
+
+//releaseCloser closes a response body and then
+//releases the request's host limits, once.
+type releaseCloser struct {
+	io.Closer
+	once    sync.Once
+	release func()
+}
+
+//Close closes the body and releases the host limits.
+func (rc *releaseCloser) Close() error {
+	err := rc.Closer.Close()
+	rc.once.Do(rc.release)
+	return err
+}
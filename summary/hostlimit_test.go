@@ -0,0 +1,174 @@
+package summary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetcherHostRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>Page</title></head></html>"))
+	}))
+	defer server.Close()
+
+	f := newTestFetcher()
+	f.HostRate = 20
+	f.HostBurst = 2
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := f.Summarize(context.Background(), server.URL); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	//the burst covers two requests, and the other two wait 50ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected the requests to be limited to 20 per second after a burst of 2, but they took %v", elapsed)
+	}
+
+	//a request that would have to wait past its deadline fails at once
+	f.HostRate = 1
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if _, err := f.Summarize(ctx, server.URL); !errors.Is(err, ErrHostBusy) {
+		t.Errorf("expected ErrHostBusy but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("expected the request to fail without waiting, but it took %v", elapsed)
+	}
+}
+
+func TestFetcherHostConcurrency(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>Page</title></head></html>"))
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	f := newTestFetcher()
+	f.HostConcurrency = 1
+	done := make(chan error)
+	go func() {
+		_, err := f.Summarize(context.Background(), server.URL+"/slow")
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := f.Summarize(ctx, server.URL+"/queued"); err == nil {
+		t.Errorf("expected a request over the host's concurrency limit to wait until its context was done")
+	}
+
+	unblock <- struct{}{}
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error from the first request: %v", err)
+	}
+	//the first request's slot is free again
+	go func() { unblock <- struct{}{} }()
+	if _, err := f.Summarize(context.Background(), server.URL+"/next"); err != nil {
+		t.Errorf("expected the host's slot to be released, but got %v", err)
+	}
+}
+
+func TestHostStateEviction(t *testing.T) {
+	f := newTestFetcher()
+	req, _ := http.NewRequest("GET", "https://busy.test/page", nil)
+	release, err := f.acquireHost(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	f.hostLimits.mu.Lock()
+	state := f.hostLimits.hosts["busy.test"]
+	//adding a host to a full table forgets the idle ones
+	fillHosts := func(prefix string) {
+		for i := 0; i <= maxTrackedHosts; i++ {
+			f.host(fmt.Sprintf("%s%d.test", prefix, i), time.Now())
+		}
+	}
+	//the state of a host with a request in flight isn't forgotten,
+	//even though it has no limits holding it
+	fillHosts("a")
+	if f.hostLimits.hosts["busy.test"] != state {
+		t.Errorf("expected the state of a host in use to be kept")
+	}
+	f.hostLimits.mu.Unlock()
+
+	release()
+	f.hostLimits.mu.Lock()
+	fillHosts("b")
+	if f.hostLimits.hosts["busy.test"] != nil {
+		t.Errorf("expected the state of an idle host to be forgotten")
+	}
+	f.hostLimits.mu.Unlock()
+}
+
+func TestFetcherRetryAfter(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>Page</title></head></html>"))
+	}))
+	defer server.Close()
+
+	f := newTestFetcher()
+	if _, err := f.Summarize(context.Background(), server.URL); err == nil {
+		t.Fatalf("expected an error for a 429 response")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := f.Summarize(ctx, server.URL); !errors.Is(err, ErrHostBusy) {
+		t.Errorf("expected the host to be paused after Retry-After, but got %v", err)
+	}
+	start := time.Now()
+	if _, err := f.Summarize(context.Background(), server.URL); err != nil {
+		t.Errorf("expected the request to succeed after the pause, but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("expected the request to wait for the pause, but it took %v", elapsed)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected 2 requests to reach the server but got %d", n)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		status   int
+		header   string
+		expected time.Duration
+	}{
+		{http.StatusTooManyRequests, "30", 30 * time.Second},
+		{http.StatusTooManyRequests, now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{http.StatusTooManyRequests, "", defaultRetryAfter},
+		{http.StatusTooManyRequests, "86400", maxRetryAfter},
+		{http.StatusServiceUnavailable, "10", 10 * time.Second},
+		{http.StatusServiceUnavailable, "", 0},
+		{http.StatusOK, "10", 0},
+	}
+	for _, c := range cases {
+		resp := &http.Response{StatusCode: c.status, Header: http.Header{}}
+		if len(c.header) > 0 {
+			resp.Header.Set("Retry-After", c.header)
+		}
+		if actual := retryAfter(resp, now); actual != c.expected {
+			t.Errorf("status %d, Retry-After %q: expected %v but got %v", c.status, c.header, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package summary
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+//HTMLExtractor reads plain HTML meta-data: the <title> element,
+//<meta name="description">, <meta name="author"> and
+//<meta name="keywords"> elements, and <link rel="icon"> and
+//<link rel="canonical"> elements.
+type HTMLExtractor struct{}
+
+//htmlMetaFields maps the names of standard <meta> elements
+//to the fields they set.
+var htmlMetaFields = map[string]Field{
+	"description": FieldDescription,
+	"author":      FieldAuthor,
+}
+
+//Name returns "html".
+func (HTMLExtractor) Name() string { return "html" }
+
+//Extract adds the plain HTML meta-data of `doc` to `c`.
+func (HTMLExtractor) Extract(doc *Document, c *Candidates) {
+	if titles := doc.Elements("title"); len(titles) > 0 {
+		c.Add(FieldTitle, Text(titles[0]), "title")
+	}
+
+	for _, meta := range metaElements(doc) {
+		key := strings.ToLower(meta.Key)
+		if field, found := htmlMetaFields[key]; found {
+			c.Add(field, meta.Content, meta.Tag)
+		} else if key == "keywords" {
+			c.AddKeywords(strings.Split(meta.Content, ","), meta.Tag)
+		}
+	}
+
+	for _, link := range doc.Elements("link") {
+		href := Attr(link, "href")
+		if len(strings.TrimSpace(href)) == 0 {
+			continue
+		}
+		rels := strings.Fields(strings.ToLower(Attr(link, "rel")))
+		for _, rel := range rels {
+			switch rel {
+			case "icon":
+				c.AddImage(FieldIcon, linkIcon(doc, link), `link[rel="icon"]`)
+			case "canonical":
+				c.Add(FieldURL, doc.ResolveURL(href), `link[rel="canonical"]`)
+			}
+		}
+	}
+}
+
+//linkIcon returns the icon described by a <link rel="icon"> element.
+//Its `sizes` attribute may be "any" or a list of sizes, in which case
+//the first size is used.
+func linkIcon(doc *Document, link *html.Node) *PreviewImage {
+	icon := &PreviewImage{
+		URL:  doc.ResolveURL(Attr(link, "href")),
+		Type: Attr(link, "type"),
+		Alt:  Attr(link, "alt"),
+	}
+	if sizes := strings.Fields(strings.ToLower(Attr(link, "sizes"))); len(sizes) > 0 {
+		if size := strings.Split(sizes[0], "x"); len(size) == 2 {
+			icon.Height, _ = strconv.Atoi(size[0])
+			icon.Width, _ = strconv.Atoi(size[1])
+		}
+	}
+	return icon
+}
@@ -0,0 +1,178 @@
+package summary
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+//JSONLDExtractor reads schema.org structured data from
+//<script type="application/ld+json"> elements.
+//See https://schema.org and https://json-ld.org.
+type JSONLDExtractor struct{}
+
+//jsonLDTag describes JSON-LD script elements for provenance.
+const jsonLDTag = `script[type="application/ld+json"]`
+
+//jsonLDIgnoredTypes are the types of items that describe something
+//other than the page, such as its publisher, so their names and
+//descriptions aren't the page's title and description.
+var jsonLDIgnoredTypes = map[string]bool{
+	"Organization":          true,
+	"Person":                true,
+	"BreadcrumbList":        true,
+	"ListItem":              true,
+	"ImageObject":           true,
+	"SearchAction":          true,
+	"SiteNavigationElement": true,
+}
+
+//Name returns "jsonld".
+func (JSONLDExtractor) Name() string { return "jsonld" }
+
+//Extract adds the schema.org properties of the JSON-LD items in `doc`
+//to `c`. Scripts that aren't valid JSON are skipped.
+func (JSONLDExtractor) Extract(doc *Document, c *Candidates) {
+	for _, script := range doc.Elements("script") {
+		if strings.ToLower(strings.TrimSpace(Attr(script, "type"))) != "application/ld+json" {
+			continue
+		}
+		if script.FirstChild == nil {
+			continue
+		}
+		var data interface{}
+		if err := json.Unmarshal([]byte(script.FirstChild.Data), &data); err != nil {
+			continue
+		}
+		for _, item := range jsonLDItems(data) {
+			extractJSONLDItem(doc, item, c)
+		}
+	}
+}
+
+//extractJSONLDItem adds the properties of one JSON-LD item to `c`.
+func extractJSONLDItem(doc *Document, item map[string]interface{}, c *Candidates) {
+	types := jsonLDStrings(item["@type"])
+	for _, t := range types {
+		if t == "WebSite" {
+			for _, name := range jsonLDStrings(item["name"]) {
+				c.Add(FieldSiteName, name, jsonLDTag+" WebSite.name")
+			}
+			return
+		}
+		if jsonLDIgnoredTypes[t] {
+			return
+		}
+	}
+
+	for _, prop := range []string{"headline", "name"} {
+		for _, title := range jsonLDStrings(item[prop]) {
+			c.Add(FieldTitle, title, jsonLDTag+" "+prop)
+		}
+	}
+	for _, description := range jsonLDStrings(item["description"]) {
+		c.Add(FieldDescription, description, jsonLDTag+" description")
+	}
+	for _, url := range jsonLDStrings(item["url"]) {
+		c.Add(FieldURL, doc.ResolveURL(url), jsonLDTag+" url")
+	}
+	for _, author := range jsonLDNames(item["author"]) {
+		c.Add(FieldAuthor, author, jsonLDTag+" author")
+	}
+	for _, publisher := range jsonLDNames(item["publisher"]) {
+		c.Add(FieldSiteName, publisher, jsonLDTag+" publisher")
+	}
+	switch keywords := item["keywords"].(type) {
+	case string:
+		c.AddKeywords(strings.Split(keywords, ","), jsonLDTag+" keywords")
+	case []interface{}:
+		c.AddKeywords(jsonLDStrings(keywords), jsonLDTag+" keywords")
+	}
+	for _, image := range jsonLDImages(item["image"]) {
+		image.URL = doc.ResolveURL(image.URL)
+		c.AddImage(FieldImages, image, jsonLDTag+" image")
+	}
+}
+
+//jsonLDItems returns the items in a JSON-LD document, which may be a
+//single item, an array of items, or an item with a @graph of items.
+func jsonLDItems(data interface{}) []map[string]interface{} {
+	var items []map[string]interface{}
+	switch v := data.(type) {
+	case []interface{}:
+		for _, elem := range v {
+			items = append(items, jsonLDItems(elem)...)
+		}
+	case map[string]interface{}:
+		if graph, found := v["@graph"]; found {
+			return jsonLDItems(graph)
+		}
+		items = append(items, v)
+	}
+	return items
+}
+
+//jsonLDStrings returns the string values of a property,
+//which may be a single string or an array.
+func jsonLDStrings(value interface{}) []string {
+	var values []string
+	switch v := value.(type) {
+	case string:
+		values = append(values, v)
+	case []interface{}:
+		for _, elem := range v {
+			if s, ok := elem.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+//jsonLDNames returns the names of a property whose values may be
+//strings or items with a name, such as a Person, or an array of them.
+func jsonLDNames(value interface{}) []string {
+	var names []string
+	switch v := value.(type) {
+	case string:
+		names = append(names, v)
+	case map[string]interface{}:
+		names = append(names, jsonLDStrings(v["name"])...)
+	case []interface{}:
+		for _, elem := range v {
+			names = append(names, jsonLDNames(elem)...)
+		}
+	}
+	return names
+}
+
+//jsonLDImages returns the images of a property whose values may be
+//URLs or ImageObject items, or an array of them.
+func jsonLDImages(value interface{}) []*PreviewImage {
+	var images []*PreviewImage
+	switch v := value.(type) {
+	case string:
+		images = append(images, &PreviewImage{URL: v})
+	case map[string]interface{}:
+		img := &PreviewImage{}
+		for _, prop := range []string{"url", "contentUrl"} {
+			if urls := jsonLDStrings(v[prop]); len(urls) > 0 && len(img.URL) == 0 {
+				img.URL = urls[0]
+			}
+		}
+		if width, ok := v["width"].(float64); ok {
+			img.Width = int(width)
+		}
+		if height, ok := v["height"].(float64); ok {
+			img.Height = int(height)
+		}
+		if caption, ok := v["caption"].(string); ok {
+			img.Alt = caption
+		}
+		images = append(images, img)
+	case []interface{}:
+		for _, elem := range v {
+			images = append(images, jsonLDImages(elem)...)
+		}
+	}
+	return images
+}
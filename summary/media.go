@@ -0,0 +1,94 @@
+package summary
+
+import (
+	"image"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	//register decoders so image.DecodeConfig can read their headers
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+//imageFormatTypes maps the format names reported by
+//image.DecodeConfig to their media types.
+var imageFormatTypes = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+}
+
+//DecodeImageHeader reads just enough of `r` to determine the
+//media type and dimensions of a PNG, JPEG, GIF or WebP image.
+func DecodeImageHeader(r io.Reader) (*PreviewImage, error) {
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	return &PreviewImage{
+		Type:   imageFormatTypes[format],
+		Width:  config.Width,
+		Height: config.Height,
+	}, nil
+}
+
+//extractImageSummary summarizes a direct link to an image. Only the
+//image header is decoded, and the image itself is the preview image.
+//Formats we can't decode are still summarized, just without dimensions.
+func extractImageSummary(pageURL string, mediaType string, page *Page) (*PageSummary, error) {
+	img, err := DecodeImageHeader(page.Body)
+	if err != nil {
+		img = &PreviewImage{Type: mediaType}
+	}
+	img.URL = pageURL
+	if len(img.Type) == 0 {
+		img.Type = mediaType
+	}
+
+	summary := newMediaSummary(pageURL, "image", page)
+	summary.ContentType = img.Type
+	summary.Images = []*PreviewImage{img}
+	return summary, nil
+}
+
+//extractMediaSummary summarizes a direct link to an audio or video file.
+//The body is not read: the summary is built from the response headers.
+func extractMediaSummary(pageURL string, mediaType string, page *Page) *PageSummary {
+	summary := newMediaSummary(pageURL, strings.SplitN(mediaType, "/", 2)[0], page)
+	summary.ContentType = mediaType
+	return summary
+}
+
+//newMediaSummary returns a PageSummary for a direct link to a media
+//file, titled with the file name from the URL.
+func newMediaSummary(pageURL string, summaryType string, page *Page) *PageSummary {
+	summary := &PageSummary{
+		Type:  summaryType,
+		URL:   pageURL,
+		Title: fileNameTitle(pageURL),
+	}
+	if page.ContentLength > 0 {
+		summary.Size = page.ContentLength
+	}
+	return summary
+}
+
+//fileNameTitle returns the unescaped file name from the path of `pageURL`,
+//falling back to the host name if the path doesn't end with a file name.
+func fileNameTitle(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return u.Hostname()
+	}
+	return name
+}
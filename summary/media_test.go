@@ -0,0 +1,106 @@
+package summary
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"Assignment1Summary/internal/testimage"
+)
+
+func TestFetchSummaryMedia(t *testing.T) {
+	//a lossless WebP header for a 3x2 image
+	webp := []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x02\x40\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	cases := []struct {
+		name            string
+		hint            string
+		path            string
+		ctype           string
+		body            []byte
+		expectedSummary *PageSummary
+	}{
+		{
+			"PNG",
+			"Direct links to PNG images should report the image dimensions",
+			"/photo.png",
+			"image/png",
+			testimage.Encode(t, "png", 40, 30),
+			&PageSummary{
+				Type:        "image",
+				Title:       "photo.png",
+				ContentType: "image/png",
+				Images: []*PreviewImage{
+					{Type: "image/png", Width: 40, Height: 30},
+				},
+			},
+		},
+		{
+			"GIF with generic content type",
+			"The image type should be sniffed when the server sends a generic content type",
+			"/files/anim.gif",
+			"application/octet-stream",
+			testimage.Encode(t, "gif", 10, 20),
+			&PageSummary{
+				Type:        "image",
+				Title:       "anim.gif",
+				ContentType: "image/gif",
+				Images: []*PreviewImage{
+					{Type: "image/gif", Width: 10, Height: 20},
+				},
+			},
+		},
+		{
+			"WebP",
+			"WebP headers should be decoded too",
+			"/pic.webp",
+			"image/webp",
+			webp,
+			&PageSummary{
+				Type:        "image",
+				Title:       "pic.webp",
+				ContentType: "image/webp",
+				Images: []*PreviewImage{
+					{Type: "image/webp", Width: 3, Height: 2},
+				},
+			},
+		},
+		{
+			"Video",
+			"Video files should be summarized from their headers",
+			"/clips/my%20clip.mp4",
+			"video/mp4",
+			[]byte("not really a video"),
+			&PageSummary{
+				Type:        "video",
+				Title:       "my clip.mp4",
+				ContentType: "video/mp4",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", c.ctype)
+			w.Write(c.body)
+		}))
+
+		pageURL := server.URL + c.path
+		summary, err := newTestFetcher().Summarize(context.Background(), pageURL)
+		if err != nil {
+			t.Errorf("case %s: unexpected error %v\nHINT: %s", c.name, err, c.hint)
+			server.Close()
+			continue
+		}
+		c.expectedSummary.URL = pageURL
+		c.expectedSummary.Size = int64(len(c.body))
+		if len(c.expectedSummary.Images) > 0 {
+			c.expectedSummary.Images[0].URL = pageURL
+		}
+		if !reflect.DeepEqual(summary, c.expectedSummary) {
+			t.Errorf("case %s: incorrect result:\nEXPECTED: %+v\nACTUAL: %+v\nHINT: %s", c.name, c.expectedSummary, summary, c.hint)
+		}
+		server.Close()
+	}
+}
@@ -0,0 +1,59 @@
+package summary
+
+import (
+	"strconv"
+	"strings"
+)
+
+//OpenGraphExtractor reads Open Graph <meta property="og:..."> elements.
+//See http://ogp.me/.
+type OpenGraphExtractor struct{}
+
+//openGraphFields maps Open Graph properties to the fields they set.
+var openGraphFields = map[string]Field{
+	"og:type":        FieldType,
+	"og:url":         FieldURL,
+	"og:title":       FieldTitle,
+	"og:site_name":   FieldSiteName,
+	"og:description": FieldDescription,
+}
+
+//Name returns "opengraph".
+func (OpenGraphExtractor) Name() string { return "opengraph" }
+
+//Extract adds the Open Graph properties of `doc` to `c`.
+func (OpenGraphExtractor) Extract(doc *Document, c *Candidates) {
+	var recentImage *PreviewImage
+	for _, meta := range metaElements(doc) {
+		if field, found := openGraphFields[meta.Key]; found {
+			if field == FieldURL {
+				meta.Content = doc.ResolveURL(meta.Content)
+			}
+			c.Add(field, meta.Content, meta.Tag)
+			continue
+		}
+
+		if meta.Key == "og:image" {
+			recentImage = &PreviewImage{URL: doc.ResolveURL(meta.Content)}
+			c.AddImage(FieldImages, recentImage, meta.Tag)
+			continue
+		}
+		//structured properties describe the most recent image,
+		//so ignore any that come before the first image
+		if !strings.HasPrefix(meta.Key, "og:image:") || recentImage == nil {
+			continue
+		}
+		switch meta.Key {
+		case "og:image:secure_url":
+			recentImage.SecureURL = doc.ResolveURL(meta.Content)
+		case "og:image:alt":
+			recentImage.Alt = meta.Content
+		case "og:image:type":
+			recentImage.Type = meta.Content
+		case "og:image:width":
+			recentImage.Width, _ = strconv.Atoi(meta.Content)
+		case "og:image:height":
+			recentImage.Height, _ = strconv.Atoi(meta.Content)
+		}
+	}
+}
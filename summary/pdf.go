@@ -0,0 +1,592 @@
+package summary
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+//pdfHeadBytes is the most we read from the start of a PDF. Linearized
+//PDFs have their trailer and document info near the start of the file.
+const pdfHeadBytes = 1 << 20
+
+//pdfTailBytes is the most we read from the end of a PDF with a Range
+//request. Other PDFs have their trailer and document info near the end.
+const pdfTailBytes = 256 << 10
+
+//pdfMaxStreamBytes limits how much we inflate from a single
+//compressed object or metadata stream.
+const pdfMaxStreamBytes = 4 << 20
+
+//pdfMaxInflatedBytes limits how much we inflate from all of a
+//document's compressed streams together, so that a small document
+//full of compressed streams can't expand to gigabytes.
+const pdfMaxInflatedBytes = 16 << 20
+
+var (
+	pdfObjectPattern = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	pdfRefPattern    = regexp.MustCompile(`^(\d+)\s+(\d+)\s+R`)
+	pdfInfoPattern   = regexp.MustCompile(`/Info\s+(\d+)\s+\d+\s+R`)
+	pdfRootPattern   = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+	pdfPagesPattern  = regexp.MustCompile(`/Pages\s+(\d+)\s+\d+\s+R`)
+	pdfCountPattern  = regexp.MustCompile(`/Count\s+(\d+)`)
+	pdfTypePages     = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pdfObjStmPattern = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	pdfFlatePattern  = regexp.MustCompile(`/FlateDecode\b`)
+	pdfXMLPattern    = regexp.MustCompile(`/Subtype\s*/XML\b`)
+	pdfDatePattern   = regexp.MustCompile(`^(?:D:)?(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?([Zz+\-])?(\d{2})?'?(\d{2})?`)
+)
+
+//pdfInfo is the document metadata we read from a PDF.
+type pdfInfo struct {
+	Title     string
+	Author    string
+	Subject   string
+	Keywords  []string
+	Created   string
+	PageCount int
+}
+
+//extractPDFSummary summarizes a PDF document from its document information
+//dictionary and XMP metadata. Rather than downloading the whole document,
+//it reads the start of the response body and, for larger documents, the
+//end of the file using a Range request.
+func (f *Fetcher) extractPDFSummary(ctx context.Context, pageURL string, page *Page) (*PageSummary, error) {
+	data, err := io.ReadAll(io.LimitReader(page.Body, pdfHeadBytes))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == pdfHeadBytes && page.ContentLength != int64(len(data)) {
+		//close the body first, so the Range request doesn't
+		//wait for it under the fetcher's per-host limits
+		page.Body.Close()
+		tail, err := f.fetchPDFTail(ctx, pageURL)
+		if err == nil {
+			data = append(append(data, '\n'), tail...)
+		}
+	}
+
+	info := parsePDFInfo(data)
+	summary := newMediaSummary(pageURL, "document", page)
+	summary.ContentType = "application/pdf"
+	if len(info.Title) > 0 {
+		summary.Title = info.Title
+	}
+	summary.Author = info.Author
+	summary.Description = info.Subject
+	summary.Keywords = info.Keywords
+	summary.Created = info.Created
+	summary.PageCount = info.PageCount
+	return summary, nil
+}
+
+//fetchPDFTail requests the last pdfTailBytes of `pageURL`.
+//An error is returned if the server doesn't honor the Range request.
+func (f *Fetcher) fetchPDFTail(ctx context.Context, pageURL string) ([]byte, error) {
+	page, err := f.FetchRange(ctx, pageURL, fmt.Sprintf("-%d", pdfTailBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer page.Body.Close()
+	if page.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("range request status code was %d", page.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(page.Body, pdfTailBytes))
+}
+
+//parsePDFInfo reads the document metadata from the raw bytes of a PDF,
+//which may be only the start and end of the file. XMP metadata takes
+//precedence over the older document information dictionary.
+func parsePDFInfo(data []byte) *pdfInfo {
+	budget := int64(pdfMaxInflatedBytes)
+	objects := pdfObjects(data, &budget)
+	info := &pdfInfo{}
+
+	if m := lastSubmatch(pdfInfoPattern, data); m != nil {
+		if dict, ok := objects[string(m)]; ok {
+			info.Title = pdfDictString(dict, "Title", objects)
+			info.Author = pdfDictString(dict, "Author", objects)
+			info.Subject = pdfDictString(dict, "Subject", objects)
+			info.Keywords = splitKeywords(pdfDictString(dict, "Keywords", objects))
+			info.Created = pdfDate(pdfDictString(dict, "CreationDate", objects))
+		}
+	}
+
+	info.PageCount = pdfPageCount(data, objects)
+
+	for _, body := range objects {
+		if xmp := xmpPacket(body, &budget); xmp != nil {
+			mergeXMP(info, xmp)
+			break
+		}
+	}
+	if xmp := xmpPacket(data, &budget); xmp != nil {
+		mergeXMP(info, xmp)
+	}
+	return info
+}
+
+//pdfObjects returns the bodies of the indirect objects found in `data`,
+//keyed by object number, including objects stored in compressed object
+//streams, which are inflated within `budget`. Later definitions replace
+//earlier ones, as they do in incrementally updated PDFs.
+func pdfObjects(data []byte, budget *int64) map[string][]byte {
+	objects := map[string][]byte{}
+	matches := pdfObjectPattern.FindAllSubmatchIndex(data, -1)
+	for i, m := range matches {
+		end := len(data)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		body := data[m[1]:end]
+		if idx := bytes.Index(body, []byte("endobj")); idx >= 0 {
+			body = body[:idx]
+		}
+		objects[string(data[m[2]:m[3]])] = body
+	}
+
+	streams := [][]byte{}
+	for _, body := range objects {
+		if pdfObjStmPattern.Match(body) {
+			streams = append(streams, body)
+		}
+	}
+	for _, body := range streams {
+		stream := pdfStream(body, budget)
+		first, _ := strconv.Atoi(pdfDictToken(body, "First"))
+		if stream == nil || first <= 0 || first > len(stream) {
+			continue
+		}
+		//the stream starts with pairs of object numbers and offsets
+		fields := strings.Fields(string(stream[:first]))
+		for i := 0; i+1 < len(fields); i += 2 {
+			//offsets come from the file, so they may be out of range
+			start, err := strconv.Atoi(fields[i+1])
+			if err != nil || start < 0 || first+start > len(stream) {
+				continue
+			}
+			end := len(stream)
+			if i+3 < len(fields) {
+				if next, err := strconv.Atoi(fields[i+3]); err == nil && next >= start && first+next <= len(stream) {
+					end = first + next
+				}
+			}
+			if first+start > end {
+				continue
+			}
+			if _, found := objects[fields[i]]; !found {
+				objects[fields[i]] = stream[first+start : end]
+			}
+		}
+	}
+	return objects
+}
+
+//pdfStream returns the stream data of an object body, inflating it if
+//it uses the FlateDecode filter. `budget` is how many more bytes may be
+//inflated from the document, which is reduced by the bytes inflated.
+//Once it runs out, compressed streams are skipped.
+func pdfStream(body []byte, budget *int64) []byte {
+	start := bytes.Index(body, []byte("stream"))
+	end := bytes.LastIndex(body, []byte("endstream"))
+	if start < 0 || end < start {
+		return nil
+	}
+	dict := body[:start]
+	start += len("stream")
+	if start < len(body) && body[start] == '\r' {
+		start++
+	}
+	if start < len(body) && body[start] == '\n' {
+		start++
+	}
+	if start > end {
+		return nil
+	}
+	raw := body[start:end]
+	if !pdfFlatePattern.Match(dict) {
+		return raw
+	}
+	limit := int64(pdfMaxStreamBytes)
+	if *budget < limit {
+		limit = *budget
+	}
+	if limit <= 0 {
+		return nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+	defer zr.Close()
+	//truncated streams still yield what could be inflated
+	inflated, _ := io.ReadAll(io.LimitReader(zr, limit))
+	*budget -= int64(len(inflated))
+	return inflated
+}
+
+//pdfPageCount returns the page count from the document's page tree root,
+//falling back to the largest count of any page tree node we found.
+func pdfPageCount(data []byte, objects map[string][]byte) int {
+	if root := lastSubmatch(pdfRootPattern, data); root != nil {
+		if catalog, ok := objects[string(root)]; ok {
+			if m := pdfPagesPattern.FindSubmatch(catalog); m != nil {
+				if pages, ok := objects[string(m[1])]; ok {
+					if c := pdfCountPattern.FindSubmatch(pages); c != nil {
+						count, _ := strconv.Atoi(string(c[1]))
+						return count
+					}
+				}
+			}
+		}
+	}
+	max := 0
+	for _, body := range objects {
+		if !pdfTypePages.Match(body) {
+			continue
+		}
+		if c := pdfCountPattern.FindSubmatch(body); c != nil {
+			if count, _ := strconv.Atoi(string(c[1])); count > max {
+				max = count
+			}
+		}
+	}
+	return max
+}
+
+//lastSubmatch returns the first submatch of the last match of `pattern`
+//in `data`, since the last trailer in a PDF is the current one.
+func lastSubmatch(pattern *regexp.Regexp, data []byte) []byte {
+	matches := pattern.FindAllSubmatch(data, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches[len(matches)-1][1]
+}
+
+//pdfDictValueStart returns the index in `dict` just past the name `/key`,
+//or -1 if the dictionary has no such key.
+func pdfDictValueStart(dict []byte, key string) int {
+	name := []byte("/" + key)
+	for offset := 0; ; {
+		idx := bytes.Index(dict[offset:], name)
+		if idx < 0 {
+			return -1
+		}
+		end := offset + idx + len(name)
+		if end == len(dict) || isPDFDelimiter(dict[end]) {
+			return end
+		}
+		offset = end
+	}
+}
+
+//pdfDictToken returns the simple (number or name) value of `key` in `dict`.
+func pdfDictToken(dict []byte, key string) string {
+	start := pdfDictValueStart(dict, key)
+	if start < 0 {
+		return ""
+	}
+	fields := bytes.Fields(dict[start:])
+	if len(fields) == 0 {
+		return ""
+	}
+	return string(bytes.TrimRight(fields[0], "/>]"))
+}
+
+//pdfDictString returns the text string value of `key` in `dict`,
+//following an indirect reference to the string if needed.
+func pdfDictString(dict []byte, key string, objects map[string][]byte) string {
+	start := pdfDictValueStart(dict, key)
+	if start < 0 {
+		return ""
+	}
+	value := bytes.TrimLeft(dict[start:], " \t\r\n\f\x00")
+	if m := pdfRefPattern.FindSubmatch(value); m != nil {
+		if obj, ok := objects[string(m[1])]; ok {
+			value = bytes.TrimLeft(obj, " \t\r\n\f\x00")
+		}
+	}
+	return strings.TrimSpace(decodePDFString(value))
+}
+
+//isPDFDelimiter reports whether `b` ends a PDF name.
+func isPDFDelimiter(b byte) bool {
+	return strings.IndexByte(" \t\r\n\f\x00()<>[]{}/%", b) >= 0
+}
+
+//decodePDFString decodes the literal or hexadecimal string at the start
+//of `value` into UTF-8 text.
+func decodePDFString(value []byte) string {
+	if len(value) == 0 {
+		return ""
+	}
+	var raw []byte
+	switch {
+	case value[0] == '(':
+		raw = decodePDFLiteral(value[1:])
+	case value[0] == '<' && (len(value) < 2 || value[1] != '<'):
+		raw = decodePDFHex(value[1:])
+	default:
+		return ""
+	}
+	return pdfTextString(raw)
+}
+
+//decodePDFLiteral decodes a literal string up to its closing parenthesis.
+func decodePDFLiteral(value []byte) []byte {
+	out := []byte{}
+	depth := 0
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return out
+			}
+			depth--
+		case '\\':
+			i++
+			if i == len(value) {
+				return out
+			}
+			switch e := value[i]; e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				//a backslash at the end of a line continues the string
+				if e == '\r' && i+1 < len(value) && value[i+1] == '\n' {
+					i++
+				}
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					n := 0
+					for j := 0; j < 3 && i < len(value) && value[i] >= '0' && value[i] <= '7'; j++ {
+						n = n*8 + int(value[i]-'0')
+						i++
+					}
+					i--
+					c = byte(n)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+//decodePDFHex decodes a hexadecimal string up to its closing angle bracket.
+func decodePDFHex(value []byte) []byte {
+	digits := []byte{}
+	for _, c := range value {
+		if c == '>' {
+			break
+		}
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		n, _ := strconv.ParseUint(string(digits[i*2:i*2+2]), 16, 8)
+		out[i] = byte(n)
+	}
+	return out
+}
+
+//pdfTextString converts a PDF text string, which is either UTF-16BE with
+//a byte order mark or PDFDocEncoding, to UTF-8. PDFDocEncoding matches
+//Latin-1 for the characters that matter in titles and names.
+func pdfTextString(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xfe && raw[1] == 0xff {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	if len(raw) >= 3 && raw[0] == 0xef && raw[1] == 0xbb && raw[2] == 0xbf {
+		return string(raw[3:])
+	}
+	runes := make([]rune, len(raw))
+	for i, b := range raw {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+//pdfDate converts a PDF date string such as D:20190102150405-08'00'
+//to RFC 3339 format, returning an empty string if it can't be parsed.
+func pdfDate(s string) string {
+	m := pdfDatePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return ""
+	}
+	num := func(s string, def int) int {
+		if len(s) == 0 {
+			return def
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	loc := time.UTC
+	if m[7] == "+" || m[7] == "-" {
+		offset := num(m[8], 0)*3600 + num(m[9], 0)*60
+		if m[7] == "-" {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+	t := time.Date(num(m[1], 0), time.Month(num(m[2], 1)), num(m[3], 1),
+		num(m[4], 0), num(m[5], 0), num(m[6], 0), 0, loc)
+	return t.Format(time.RFC3339)
+}
+
+//xmpPacket returns the XMP metadata packet in an object body or in
+//the raw PDF data, or nil if there is none. Compressed packets are
+//inflated within `budget`, as pdfStream does.
+func xmpPacket(data []byte, budget *int64) []byte {
+	if !bytes.Contains(data, []byte("xmpmeta")) {
+		if !pdfXMLPattern.Match(data) {
+			return nil
+		}
+		data = pdfStream(data, budget)
+	}
+	start := bytes.Index(data, []byte("<x:xmpmeta"))
+	end := bytes.Index(data, []byte("</x:xmpmeta>"))
+	if start < 0 || end < start {
+		return nil
+	}
+	return data[start : end+len("</x:xmpmeta>")]
+}
+
+//xmpNode is a generic XML element in an XMP packet.
+type xmpNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []xmpNode  `xml:",any"`
+}
+
+//XML namespaces of the XMP properties we read.
+const (
+	xmpNamespaceDC  = "http://purl.org/dc/elements/1.1/"
+	xmpNamespacePDF = "http://ns.adobe.com/pdf/1.3/"
+	xmpNamespaceXMP = "http://ns.adobe.com/xap/1.0/"
+)
+
+//mergeXMP overwrites the fields of `info` with
+//any values found in the XMP packet `packet`.
+func mergeXMP(info *pdfInfo, packet []byte) {
+	root := xmpNode{}
+	if err := xml.Unmarshal(packet, &root); err != nil {
+		return
+	}
+	values := map[xml.Name][]string{}
+	var walk func(n *xmpNode)
+	walk = func(n *xmpNode) {
+		for _, attr := range n.Attrs {
+			values[attr.Name] = append(values[attr.Name], attr.Value)
+		}
+		for i := range n.Children {
+			child := &n.Children[i]
+			if child.XMLName.Space == xmpNamespaceDC || child.XMLName.Space == xmpNamespacePDF ||
+				child.XMLName.Space == xmpNamespaceXMP {
+				values[child.XMLName] = append(values[child.XMLName], xmpValues(child)...)
+				continue
+			}
+			walk(child)
+		}
+	}
+	walk(&root)
+
+	first := func(space string, local string) string {
+		for _, v := range values[xml.Name{Space: space, Local: local}] {
+			if v = strings.TrimSpace(v); len(v) > 0 {
+				return v
+			}
+		}
+		return ""
+	}
+	if title := first(xmpNamespaceDC, "title"); len(title) > 0 {
+		info.Title = title
+	}
+	if creators := values[xml.Name{Space: xmpNamespaceDC, Local: "creator"}]; len(creators) > 0 {
+		info.Author = strings.Join(creators, ", ")
+	}
+	if description := first(xmpNamespaceDC, "description"); len(description) > 0 {
+		info.Subject = description
+	}
+	if keywords := first(xmpNamespacePDF, "Keywords"); len(keywords) > 0 {
+		info.Keywords = splitKeywords(keywords)
+	} else if subjects := values[xml.Name{Space: xmpNamespaceDC, Local: "subject"}]; len(subjects) > 0 {
+		info.Keywords = subjects
+	}
+	if created := first(xmpNamespaceXMP, "CreateDate"); len(created) > 0 {
+		if t, err := parseXMPDate(created); err == nil {
+			info.Created = t.Format(time.RFC3339)
+		}
+	}
+}
+
+//xmpValues returns the text values of an XMP property,
+//which may be a simple value or an rdf:Alt, rdf:Seq or rdf:Bag.
+func xmpValues(n *xmpNode) []string {
+	values := []string{}
+	for i := range n.Children {
+		values = append(values, xmpValues(&n.Children[i])...)
+	}
+	if len(values) == 0 {
+		if text := strings.TrimSpace(n.Text); len(text) > 0 {
+			values = append(values, text)
+		}
+	}
+	return values
+}
+
+//parseXMPDate parses the ISO 8601 subset XMP uses for dates.
+func parseXMPDate(s string) (time.Time, error) {
+	layouts := []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04Z07:00", "2006-01-02T15:04", "2006-01-02", "2006-01", "2006"}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid XMP date %q", s)
+}
+
+//splitKeywords splits a comma or semicolon separated keywords string.
+func splitKeywords(s string) []string {
+	var keywords []string
+	for _, k := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' }) {
+		if k = strings.TrimSpace(k); len(k) > 0 {
+			keywords = append(keywords, k)
+		}
+	}
+	return keywords
+}
@@ -0,0 +1,201 @@
+package summary
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+//buildTestPDF returns a minimal PDF with the given objects,
+//`padding` bytes of comments after the header, and a trailer.
+func buildTestPDF(objects []string, trailer string, padding int) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("%PDF-1.7\n")
+	for buf.Len() < padding {
+		buf.WriteString("% padding padding padding padding padding padding padding\n")
+	}
+	for i, obj := range objects {
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	fmt.Fprintf(buf, "trailer\n%s\n%%%%EOF\n", trailer)
+	return buf.Bytes()
+}
+
+func deflate(s string) string {
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	zw.Write([]byte(s))
+	zw.Close()
+	return buf.String()
+}
+
+func TestExtractPDFSummary(t *testing.T) {
+	xmp := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+	<rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:pdf="http://ns.adobe.com/pdf/1.3/" xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+		pdf:Keywords="xmp, metadata" xmp:CreateDate="2020-05-06T07:08:09Z">
+	<dc:title><rdf:Alt><rdf:li xml:lang="x-default">XMP Title</rdf:li></rdf:Alt></dc:title>
+	<dc:creator><rdf:Seq><rdf:li>Ada</rdf:li><rdf:li>Grace</rdf:li></rdf:Seq></dc:creator>
+	</rdf:Description></rdf:RDF></x:xmpmeta>`
+	objStm := "5 0 6 70 " +
+		"<< /Title (Compressed \\(Info\\)) /Author <FEFF00C9006D0069006C0065> >>" +
+		"<< /Type /Pages /Kids [] /Count 12 >>"
+	cases := []struct {
+		name            string
+		hint            string
+		pdf             []byte
+		expectedSummary *PageSummary
+	}{
+		{
+			"Info Dictionary",
+			"Make sure you read the document information dictionary referenced by the trailer",
+			buildTestPDF([]string{
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 3 >>",
+				"<< /Type /Page /Parent 2 0 R >>",
+				`<< /Title (Test Paper) /Author (Jane Doe) /Subject (A study of tests)
+				   /Keywords (one, two; three) /CreationDate (D:20190102150405-08'00') >>`,
+			}, "<< /Root 1 0 R /Info 4 0 R >>", 0),
+			&PageSummary{
+				Type:        "document",
+				Title:       "Test Paper",
+				Author:      "Jane Doe",
+				Description: "A study of tests",
+				Keywords:    []string{"one", "two", "three"},
+				Created:     "2019-01-02T15:04:05-08:00",
+				PageCount:   3,
+			},
+		},
+		{
+			"XMP Metadata",
+			"XMP metadata should take precedence over the document information dictionary",
+			buildTestPDF([]string{
+				"<< /Type /Catalog /Pages 2 0 R /Metadata 3 0 R >>",
+				"<< /Type /Pages /Kids [] /Count 1 >>",
+				fmt.Sprintf("<< /Type /Metadata /Subtype /XML /Length %d >>\nstream\n%s\nendstream", len(xmp), xmp),
+				"<< /Title (Info Title) /Subject (Info Subject) >>",
+			}, "<< /Root 1 0 R /Info 4 0 R >>", 0),
+			&PageSummary{
+				Type:        "document",
+				Title:       "XMP Title",
+				Author:      "Ada, Grace",
+				Description: "Info Subject",
+				Keywords:    []string{"xmp", "metadata"},
+				Created:     "2020-05-06T07:08:09Z",
+				PageCount:   1,
+			},
+		},
+		{
+			"Compressed Object Stream",
+			"PDF 1.5 files may store the document info and page tree in compressed object streams",
+			buildTestPDF([]string{
+				"<< /Type /Catalog /Pages 6 0 R >>",
+				"",
+				"",
+				fmt.Sprintf("<< /Type /ObjStm /N 2 /First 9 /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream",
+					len(deflate(objStm)), deflate(objStm)),
+			}, "<< /Root 1 0 R /Info 5 0 R >>", 0),
+			&PageSummary{
+				Type:      "document",
+				Title:     "Compressed (Info)",
+				Author:    "Émile",
+				PageCount: 12,
+			},
+		},
+		{
+			"Malformed Object Stream",
+			"out of range offsets in object streams should be skipped, rather than panicking",
+			buildTestPDF([]string{
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [] /Count 1 >>",
+				"<< /Type /ObjStm /First 5 >> stream\n5 -10 (x)\nendstream",
+				"<< /Type /ObjStm /First 20 >> stream\n6 -30 7 -20 8 99 9 4 10 2 (x)\nendstream",
+				"<< /Type /ObjStm /First -5 >> stream\n11 0 (x)\nendstream",
+			}, "<< /Root 1 0 R >>", 0),
+			&PageSummary{
+				Type:      "document",
+				Title:     "report.pdf",
+				PageCount: 1,
+			},
+		},
+		{
+			"Large Document",
+			"Large PDFs should read the trailer from the end of the file with a Range request",
+			buildTestPDF([]string{
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [] /Count 200 >>",
+				"<< /Title (Big Report) >>",
+			}, "<< /Root 1 0 R /Info 3 0 R >>", pdfHeadBytes+1000),
+			&PageSummary{
+				Type:      "document",
+				Title:     "Big Report",
+				PageCount: 200,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/pdf")
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(c.pdf))
+		}))
+
+		pageURL := server.URL + "/files/report.pdf"
+		summary, err := newTestFetcher().Summarize(context.Background(), pageURL)
+		if err != nil {
+			t.Errorf("case %s: unexpected error %v\nHINT: %s", c.name, err, c.hint)
+			server.Close()
+			continue
+		}
+		c.expectedSummary.URL = pageURL
+		c.expectedSummary.ContentType = "application/pdf"
+		c.expectedSummary.Size = int64(len(c.pdf))
+		if !reflect.DeepEqual(summary, c.expectedSummary) {
+			t.Errorf("case %s: incorrect result:\nEXPECTED: %+v\nACTUAL: %+v\nHINT: %s", c.name, c.expectedSummary, summary, c.hint)
+		}
+		server.Close()
+	}
+}
+
+func TestPDFInflateBudget(t *testing.T) {
+	//each object stream inflates to the most of a single stream
+	bomb := fmt.Sprintf("<< /Type /ObjStm /Filter /FlateDecode /First 1 >>\nstream\n%s\nendstream",
+		deflate(strings.Repeat("0", pdfMaxStreamBytes)))
+	objects := []string{}
+	for i := 0; i < 10; i++ {
+		objects = append(objects, bomb)
+	}
+	data := buildTestPDF(objects, "<< >>", 0)
+
+	budget := int64(pdfMaxInflatedBytes)
+	pdfObjects(data, &budget)
+	if budget != 0 {
+		t.Errorf("expected the whole budget of %d bytes to be used, but %d bytes were left", pdfMaxInflatedBytes, budget)
+	}
+	if stream := pdfStream([]byte(bomb), &budget); stream != nil || budget != 0 {
+		t.Errorf("expected nothing to be inflated once the budget ran out, but got %d bytes", len(stream))
+	}
+}
+
+func TestPDFDate(t *testing.T) {
+	cases := map[string]string{
+		"D:20190102150405-08'00'": "2019-01-02T15:04:05-08:00",
+		"D:20190102150405Z":       "2019-01-02T15:04:05Z",
+		"D:2019":                  "2019-01-01T00:00:00Z",
+		"not a date":              "",
+	}
+	for input, expected := range cases {
+		if actual := pdfDate(input); actual != expected {
+			t.Errorf("pdfDate(%q): expected %q but got %q", input, expected, actual)
+		}
+	}
+	if actual := strings.Join(splitKeywords(" a ,b;; c "), "|"); actual != "a|b|c" {
+		t.Errorf("splitKeywords: expected %q but got %q", "a|b|c", actual)
+	}
+}
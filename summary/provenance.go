@@ -0,0 +1,40 @@
+package summary
+
+//FieldProvenance describes where the value of a summary field came from.
+type FieldProvenance struct {
+	//Source is the name of the extractor that found the value.
+	Source string `json:"source"`
+	//Tag describes the element the value was found in.
+	//For keywords and images found in several elements,
+	//it describes the first of them.
+	Tag string `json:"tag"`
+	//Alternatives are the other values found for the field,
+	//in order of precedence, which lost to the chosen one.
+	Alternatives []*Candidate `json:"alternatives,omitempty"`
+}
+
+//Provenance describes where the values of a summary's fields came from.
+type Provenance map[Field]*FieldProvenance
+
+//Provenance returns the provenance of every field that Summary
+//populates, following the same precedence.
+func (c *Candidates) Provenance() Provenance {
+	provenance := Provenance{}
+	for field, candidates := range c.fields {
+		if len(candidates) == 0 {
+			continue
+		}
+		fp := &FieldProvenance{
+			Source: candidates[0].Source,
+			Tag:    candidates[0].Tag,
+		}
+		for i, candidate := range candidates {
+			if i == 0 || ((field == FieldKeywords || field == FieldImages) && candidate.Source == fp.Source) {
+				continue
+			}
+			fp.Alternatives = append(fp.Alternatives, candidate)
+		}
+		provenance[field] = fp
+	}
+	return provenance
+}
@@ -0,0 +1,67 @@
+package summary
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestProvenance(t *testing.T) {
+	const page = `<html><head>
+		<meta property="og:title" content="og title">
+		<meta property="og:image" content="http://test.com/a.png">
+		<meta property="og:image" content="http://test.com/b.png">
+		<meta name="twitter:title" content="twitter title">
+		<meta name="twitter:image" content="http://test.com/c.png">
+		<meta name="description" content="html description">
+		<title>HTML Title</title>
+		</head><body></body></html>`
+
+	summary, err := Extract(context.Background(), strings.NewReader(page), "http://test.com", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if summary.Provenance != nil {
+		t.Errorf("expected no provenance unless it is requested")
+	}
+
+	summary, err = Extract(context.Background(), strings.NewReader(page), "http://test.com", &Options{Provenance: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cases := []struct {
+		field                Field
+		expectedSource       string
+		expectedTag          string
+		expectedAlternatives []string
+	}{
+		{FieldTitle, "opengraph", `meta[property="og:title"]`, []string{"twitter title", "HTML Title"}},
+		{FieldDescription, "html", `meta[name="description"]`, nil},
+		{FieldImages, "opengraph", `meta[property="og:image"]`, []string{"http://test.com/c.png"}},
+	}
+	for _, c := range cases {
+		fp := summary.Provenance[c.field]
+		if fp == nil {
+			t.Errorf("field %s: expected provenance but found none", c.field)
+			continue
+		}
+		if fp.Source != c.expectedSource || fp.Tag != c.expectedTag {
+			t.Errorf("field %s: expected source %q and tag %q but got %q and %q",
+				c.field, c.expectedSource, c.expectedTag, fp.Source, fp.Tag)
+		}
+		var alternatives []string
+		for _, alt := range fp.Alternatives {
+			if alt.Image != nil {
+				alternatives = append(alternatives, alt.Image.URL)
+			} else {
+				alternatives = append(alternatives, alt.Value)
+			}
+		}
+		if strings.Join(alternatives, "|") != strings.Join(c.expectedAlternatives, "|") {
+			t.Errorf("field %s: expected alternatives %q but got %q", c.field, c.expectedAlternatives, alternatives)
+		}
+	}
+	if _, found := summary.Provenance[FieldAuthor]; found {
+		t.Errorf("expected no provenance for fields that weren't populated")
+	}
+}
@@ -0,0 +1,377 @@
+package summary
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//ErrCacheUnavailable is returned by a RedisCache while its server is
+//unavailable, without trying to reach it. The Fetcher treats errors
+//from its Cache as misses, so it carries on without the cache.
+var ErrCacheUnavailable = errors.New("cache server is unavailable")
+
+//DefaultRedisKeyPrefix is the default prefix of a RedisCache's keys.
+const DefaultRedisKeyPrefix = "summary:"
+
+//DefaultRedisTimeout is the default time limit of each Redis command,
+//including connecting.
+const DefaultRedisTimeout = time.Second
+
+//redisRetryInterval is how long a RedisCache waits after failing
+//to reach its server before trying again.
+const redisRetryInterval = 5 * time.Second
+
+//maxIdleRedisConns is the number of idle connections a RedisCache keeps.
+const maxIdleRedisConns = 8
+
+//redisScanCount is the number of keys each SCAN command asks for.
+const redisScanCount = 500
+
+//redisGlobEscaper escapes the characters that are special in
+//the patterns of the SCAN command.
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+//maxRedisBulkBytes limits the size of a bulk string reply.
+const maxRedisBulkBytes = 64 << 20
+
+//maxRedisArrayLength limits the number of elements in an array reply.
+const maxRedisArrayLength = 1 << 20
+
+//RedisCache is a Cache kept on a server that speaks the Redis protocol,
+//so that several gateways can share it. Entries are stored as JSON. If
+//the server can't be reached, requests fail with ErrCacheUnavailable
+//for a few seconds, rather than each waiting to time out. Create
+//RedisCaches with NewRedisCache, and set any fields before first use.
+type RedisCache struct {
+	//Addr is the server's host and port.
+	Addr string
+	//Password is sent with the AUTH command, if it isn't empty.
+	Password string
+	//DB is the database number to SELECT.
+	DB int
+	//KeyPrefix is added to each key, to keep the entries apart from
+	//other data on the server.
+	KeyPrefix string
+	//TTL is how long the server keeps each entry, which should be longer
+	//than the Fetcher's CacheTTL, since expired summaries can still be
+	//revalidated. Zero means entries are kept until they are evicted.
+	TTL time.Duration
+	//Timeout limits how long each command takes, including
+	//connecting. Zero means DefaultRedisTimeout.
+	Timeout time.Duration
+
+	mu        sync.Mutex
+	idle      []*redisConn
+	downUntil time.Time
+}
+
+//redisConn is a connection to a Redis server.
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+//redisError is an error reply from a Redis server.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+//NewRedisCache returns a RedisCache for the server at `addr`.
+func NewRedisCache(addr string) *RedisCache {
+	return &RedisCache{Addr: addr, KeyPrefix: DefaultRedisKeyPrefix}
+}
+
+//Get returns the entry for `key`, or nil if there is none.
+func (rc *RedisCache) Get(ctx context.Context, key string) (*CacheEntry, error) {
+	reply, err := rc.do(ctx, "GET", rc.KeyPrefix+key)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply to GET: %v", reply)
+	}
+	entry := &CacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+//Set stores `entry` for `key`, replacing any previous entry.
+func (rc *RedisCache) Set(ctx context.Context, key string, entry *CacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	args := []string{"SET", rc.KeyPrefix + key, string(data)}
+	if rc.TTL > 0 {
+		args = append(args, "PX", strconv.FormatInt(rc.TTL.Milliseconds(), 10))
+	}
+	_, err = rc.do(ctx, args...)
+	return err
+}
+
+//Delete removes the entry for `key`, if there is one.
+func (rc *RedisCache) Delete(ctx context.Context, key string) error {
+	_, err := rc.do(ctx, "DEL", rc.KeyPrefix+key)
+	return err
+}
+
+//ScanKeys calls `fn` with each key, until it returns false. It uses
+//the SCAN command, so it doesn't block the server, but a key may be
+//seen more than once.
+func (rc *RedisCache) ScanKeys(ctx context.Context, fn func(key string) bool) error {
+	match := redisGlobEscaper.Replace(rc.KeyPrefix) + "*"
+	cursor := "0"
+	for {
+		reply, err := rc.do(ctx, "SCAN", cursor, "MATCH", match, "COUNT", strconv.Itoa(redisScanCount))
+		if err != nil {
+			return err
+		}
+		array, ok := reply.([]interface{})
+		if !ok || len(array) != 2 {
+			return fmt.Errorf("redis: unexpected reply to SCAN: %v", reply)
+		}
+		next, ok := array[0].([]byte)
+		keys, ok2 := array[1].([]interface{})
+		if !ok || !ok2 {
+			return fmt.Errorf("redis: unexpected reply to SCAN: %v", reply)
+		}
+		for _, key := range keys {
+			if data, ok := key.([]byte); ok {
+				if !fn(strings.TrimPrefix(string(data), rc.KeyPrefix)) {
+					return nil
+				}
+			}
+		}
+		cursor = string(next)
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+//CacheSize returns the number of entries in the cache and their total
+//size in bytes. It reads the size of every entry, so it is slow for
+//large caches.
+func (rc *RedisCache) CacheSize(ctx context.Context) (int, int64, error) {
+	var keys []string
+	err := rc.ScanKeys(ctx, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	//SCAN may return a key more than once
+	seen := map[string]bool{}
+	var size int64
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		reply, err := rc.do(ctx, "STRLEN", rc.KeyPrefix+key)
+		if err != nil {
+			return 0, 0, err
+		}
+		n, _ := reply.(int64)
+		size += n
+	}
+	return len(seen), size, nil
+}
+
+//timeout returns the effective Timeout of the cache.
+func (rc *RedisCache) timeout() time.Duration {
+	if rc.Timeout <= 0 {
+		return DefaultRedisTimeout
+	}
+	return rc.Timeout
+}
+
+//do sends a command to the server and returns its reply, which is nil,
+//an int64, a string for a status, []byte for a bulk string, or
+//[]interface{} for an array. Error replies are returned as errors.
+func (rc *RedisCache) do(ctx context.Context, args ...string) (interface{}, error) {
+	deadline := time.Now().Add(rc.timeout())
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn, err := rc.conn(ctx, deadline)
+	if err != nil {
+		return nil, err
+	}
+	conn.conn.SetDeadline(deadline)
+	reply, err := conn.do(args...)
+	var re redisError
+	if err != nil && !errors.As(err, &re) {
+		//the connection may be out of step with the server,
+		//so it can't be used again
+		conn.conn.Close()
+		if ctx.Err() == nil {
+			rc.failed()
+		}
+		return nil, err
+	}
+	rc.release(conn)
+	return reply, err
+}
+
+//conn returns an idle connection, or a new one.
+func (rc *RedisCache) conn(ctx context.Context, deadline time.Time) (*redisConn, error) {
+	rc.mu.Lock()
+	if time.Now().Before(rc.downUntil) {
+		rc.mu.Unlock()
+		return nil, ErrCacheUnavailable
+	}
+	if n := len(rc.idle); n > 0 {
+		conn := rc.idle[n-1]
+		rc.idle = rc.idle[:n-1]
+		rc.mu.Unlock()
+		return conn, nil
+	}
+	rc.mu.Unlock()
+
+	dialer := &net.Dialer{Deadline: deadline}
+	c, err := dialer.DialContext(ctx, "tcp", rc.Addr)
+	if err != nil {
+		if ctx.Err() == nil {
+			rc.failed()
+		}
+		return nil, err
+	}
+	conn := &redisConn{conn: c, reader: bufio.NewReader(c)}
+	c.SetDeadline(deadline)
+	if len(rc.Password) > 0 {
+		_, err = conn.do("AUTH", rc.Password)
+	}
+	if err == nil && rc.DB != 0 {
+		_, err = conn.do("SELECT", strconv.Itoa(rc.DB))
+	}
+	if err != nil {
+		//a wrong password or database won't fix itself,
+		//so don't try again for a while either
+		c.Close()
+		rc.failed()
+		return nil, err
+	}
+	return conn, nil
+}
+
+//release returns a connection to the idle pool,
+//or closes it if the pool is full.
+func (rc *RedisCache) release(conn *redisConn) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.idle) >= maxIdleRedisConns {
+		conn.conn.Close()
+		return
+	}
+	rc.idle = append(rc.idle, conn)
+}
+
+//failed marks the server as unavailable for redisRetryInterval,
+//and closes the idle connections, which are likely broken too.
+func (rc *RedisCache) failed() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.downUntil = time.Now().Add(redisRetryInterval)
+	for _, conn := range rc.idle {
+		conn.conn.Close()
+	}
+	rc.idle = nil
+}
+
+//Close closes the idle connections.
+func (rc *RedisCache) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for _, conn := range rc.idle {
+		conn.conn.Close()
+	}
+	rc.idle = nil
+	return nil
+}
+
+//do sends a command as an array of bulk strings and reads the reply.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readRedisReply(c.reader)
+}
+
+//readRedisReply reads a reply in the Redis protocol (RESP).
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, rest := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, redisError(rest)
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n > maxRedisBulkBytes {
+			return nil, fmt.Errorf("redis: malformed bulk string length %q", rest)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n > maxRedisArrayLength {
+			return nil, fmt.Errorf("redis: malformed array length %q", rest)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		array := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			element, err := readRedisReply(r)
+			var re redisError
+			if err != nil && !errors.As(err, &re) {
+				return nil, err
+			}
+			array = append(array, element)
+		}
+		return array, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
@@ -0,0 +1,243 @@
+package summary
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//fakeRedis is an in-process stand-in for a Redis server, which
+//supports the commands RedisCache uses.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+	mu       sync.Mutex
+	data     map[string]string
+	ttls     map[string]string
+}
+
+//newFakeRedis starts a fakeRedis that requires `password`, if it isn't empty.
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	fr := &fakeRedis{listener: listener, password: password, data: map[string]string{}, ttls: map[string]string{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go fr.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return fr
+}
+
+func (fr *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := len(fr.password) == 0
+	for {
+		args, err := readFakeRedisCommand(r)
+		if err != nil {
+			return
+		}
+		var reply string
+		fr.mu.Lock()
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			if args[1] == fr.password {
+				authed = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case cmd == "SELECT":
+			reply = "+OK\r\n"
+		case cmd == "GET":
+			if value, ok := fr.data[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case cmd == "SET":
+			fr.data[args[1]] = args[2]
+			if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+				fr.ttls[args[1]] = args[4]
+			}
+			reply = "+OK\r\n"
+		case cmd == "SCAN":
+			//return every key in one batch
+			prefix := strings.TrimSuffix(args[3], "*")
+			var keys []string
+			for key := range fr.data {
+				if strings.HasPrefix(key, prefix) {
+					keys = append(keys, fmt.Sprintf("$%d\r\n%s\r\n", len(key), key))
+				}
+			}
+			reply = fmt.Sprintf("*2\r\n$1\r\n0\r\n*%d\r\n%s", len(keys), strings.Join(keys, ""))
+		case cmd == "STRLEN":
+			reply = fmt.Sprintf(":%d\r\n", len(fr.data[args[1]]))
+		case cmd == "DEL":
+			_, ok := fr.data[args[1]]
+			delete(fr.data, args[1])
+			if ok {
+				reply = ":1\r\n"
+			} else {
+				reply = ":0\r\n"
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		fr.mu.Unlock()
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+//readFakeRedisCommand reads a command sent as an array of bulk strings.
+func readFakeRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad command %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		reply, err := readRedisReply(r)
+		data, ok := reply.([]byte)
+		if err != nil || !ok {
+			return nil, fmt.Errorf("bad argument %v: %v", reply, err)
+		}
+		args[i] = string(data)
+	}
+	return args, nil
+}
+
+func TestRedisCache(t *testing.T) {
+	ctx := context.Background()
+	fr := newFakeRedis(t, "secret")
+
+	//two replicas sharing the server
+	caches := []*RedisCache{NewRedisCache(fr.listener.Addr().String()), NewRedisCache(fr.listener.Addr().String())}
+	for _, rc := range caches {
+		rc.Password = "secret"
+		rc.DB = 1
+		rc.TTL = time.Hour
+	}
+	stored := time.Now().Truncate(time.Second)
+	entry := &CacheEntry{Summary: &PageSummary{Title: "Shared"}, Stored: stored, ETag: `"v1"`}
+	if err := caches[0].Set(ctx, "https://test.com/", entry); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	got, err := caches[1].Get(ctx, "https://test.com/")
+	if err != nil || got == nil || got.Summary.Title != "Shared" || got.ETag != `"v1"` || !got.Stored.Equal(stored) {
+		t.Fatalf("expected the entry stored by the other replica, but got %+v, %v", got, err)
+	}
+	fr.mu.Lock()
+	ttl := fr.ttls[DefaultRedisKeyPrefix+"https://test.com/"]
+	fr.mu.Unlock()
+	if ttl != "3600000" {
+		t.Errorf("expected the entry to be stored with a TTL of 3600000ms, but got %q", ttl)
+	}
+
+	if got, err := caches[1].Get(ctx, "https://test.com/other"); got != nil || err != nil {
+		t.Errorf("expected a miss for a missing key, but got %+v, %v", got, err)
+	}
+	if err := caches[1].Delete(ctx, "https://test.com/"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if got, err := caches[0].Get(ctx, "https://test.com/"); got != nil || err != nil {
+		t.Errorf("expected the entry to be deleted, but got %+v, %v", got, err)
+	}
+
+	wrongPassword := NewRedisCache(fr.listener.Addr().String())
+	wrongPassword.Password = "wrong"
+	if _, err := wrongPassword.Get(ctx, "https://test.com/"); err == nil {
+		t.Errorf("expected an error with the wrong password")
+	}
+}
+
+func TestRedisCacheUnavailable(t *testing.T) {
+	//a closed listener's address refuses connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx := context.Background()
+	rc := NewRedisCache(addr)
+	if _, err := rc.Get(ctx, "key"); err == nil || errors.Is(err, ErrCacheUnavailable) {
+		t.Errorf("expected a connection error, but got %v", err)
+	}
+	if _, err := rc.Get(ctx, "key"); !errors.Is(err, ErrCacheUnavailable) {
+		t.Errorf("expected ErrCacheUnavailable while the server is down, but got %v", err)
+	}
+
+	//the fetcher carries on without the cache
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Uncached</title></head></html>`))
+	}))
+	defer server.Close()
+	f := newTestFetcher()
+	f.Cache = rc
+	if s, err := f.Summarize(ctx, server.URL); err != nil || s.Title != "Uncached" {
+		t.Errorf("expected the page to be summarized without the cache, but got %+v, %v", s, err)
+	}
+}
+
+func TestReadRedisReply(t *testing.T) {
+	cases := []struct {
+		name        string
+		hint        string
+		reply       string
+		expectError bool
+	}{
+		{
+			"Array",
+			"arrays of bulk strings should be read",
+			"*2\r\n$1\r\na\r\n$1\r\nb\r\n",
+			false,
+		},
+		{
+			"Huge Array",
+			"array lengths should be limited before allocating the array",
+			"*" + strconv.Itoa(maxRedisArrayLength+1) + "\r\n",
+			true,
+		},
+		{
+			"Huge Bulk String",
+			"bulk string lengths should be limited before allocating the string",
+			"$" + strconv.Itoa(maxRedisBulkBytes+1) + "\r\n",
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		_, err := readRedisReply(bufio.NewReader(strings.NewReader(c.reply)))
+		if (err != nil) != c.expectError {
+			t.Errorf("case %s: unexpected error %v\nHINT: %s", c.name, err, c.hint)
+		}
+	}
+}
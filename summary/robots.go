@@ -0,0 +1,453 @@
+package summary
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//DefaultUserAgent is the User-Agent header a Fetcher sends by default.
+//Its product token, "SummaryBot", is the agent robots.txt rules are
+//matched against.
+const DefaultUserAgent = "SummaryBot/1.0 (link preview fetcher)"
+
+//RobotsMode controls when a Fetcher obeys robots.txt.
+type RobotsMode int
+
+const (
+	//RobotsBatch obeys robots.txt for batch work, such as crawling
+	//sitemaps, but not for requests made on behalf of a user, such as
+	//a preview of a link they shared. See WithBatch.
+	RobotsBatch RobotsMode = iota
+	//RobotsAlways obeys robots.txt for every request.
+	RobotsAlways
+	//RobotsNever ignores robots.txt.
+	RobotsNever
+)
+
+//ParseRobotsMode parses the value of the ROBOTS_MODE
+//environment variable. An empty value means RobotsBatch.
+func ParseRobotsMode(s string) (RobotsMode, error) {
+	switch s {
+	case "", "batch":
+		return RobotsBatch, nil
+	case "always":
+		return RobotsAlways, nil
+	case "never":
+		return RobotsNever, nil
+	default:
+		return RobotsBatch, fmt.Errorf("unknown robots mode %q: must be \"always\", \"batch\" or \"never\"", s)
+	}
+}
+
+//ErrDisallowed is returned when robots.txt disallows fetching a URL.
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+//robotsTTL is how long a robots.txt file is cached for.
+const robotsTTL = 24 * time.Hour
+
+//robotsErrorTTL is how long a failure to fetch robots.txt is cached
+//for, during which the whole site is treated as disallowed.
+const robotsErrorTTL = 10 * time.Minute
+
+//maxRobotsBytes limits how much of a robots.txt file is read.
+const maxRobotsBytes = 500 << 10
+
+//maxCrawlDelay limits the Crawl-delay we honor, so a site can't
+//make requests to it wait indefinitely.
+const maxCrawlDelay = 30 * time.Second
+
+//batchKey is the context key WithBatch sets.
+type batchKey struct{}
+
+//WithBatch returns a context that marks the requests made with it as
+//batch work, such as crawling or bulk summarizing, rather than requests
+//on behalf of a user. In the RobotsBatch mode, only batch requests obey
+//robots.txt.
+func WithBatch(ctx context.Context) context.Context {
+	return context.WithValue(ctx, batchKey{}, true)
+}
+
+//isBatch reports whether `ctx` was marked by WithBatch.
+func isBatch(ctx context.Context) bool {
+	batch, _ := ctx.Value(batchKey{}).(bool)
+	return batch
+}
+
+//robotsRules are the rules of a robots.txt file that apply to an agent.
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	//sitemaps are the sitemaps listed in the file,
+	//which apply to every agent
+	sitemaps []string
+}
+
+//robotsRule is an allow or disallow rule.
+type robotsRule struct {
+	allow   bool
+	pattern string
+	//match is the compiled pattern
+	match *regexp.Regexp
+}
+
+//newRobotsRule returns a rule for `pattern`.
+func newRobotsRule(allow bool, pattern string) robotsRule {
+	return robotsRule{allow: allow, pattern: pattern, match: compileRobotsPattern(pattern)}
+}
+
+//disallowAll are the rules used when robots.txt can't be fetched.
+var disallowAll = &robotsRules{rules: []robotsRule{newRobotsRule(false, "/")}}
+
+//parseRobots parses a robots.txt file and returns the rules for
+//`agent`, a product token such as "SummaryBot". Following RFC 9309,
+//the rules are those of every group naming the agent, or if there are
+//none, those of the groups for "*".
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	type group struct {
+		agents     []string
+		rules      []robotsRule
+		crawlDelay time.Duration
+	}
+	var groups []*group
+	var current *group
+	sitemaps := []string{}
+	//a user-agent line after rules starts a new group
+	inRules := true
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:colon]))
+		value := strings.TrimSpace(line[colon+1:])
+		switch key {
+		case "user-agent":
+			if inRules {
+				current = &group{}
+				groups = append(groups, current)
+				inRules = false
+			}
+			//"SummaryBot/1.0" names the SummaryBot agent
+			token := strings.SplitN(value, "/", 2)[0]
+			current.agents = append(current.agents, strings.ToLower(strings.TrimSpace(token)))
+		case "allow", "disallow":
+			inRules = true
+			//an empty disallow allows everything,
+			//which is the same as having no rule
+			if current != nil && len(value) > 0 {
+				current.rules = append(current.rules, newRobotsRule(key == "allow", value))
+			}
+		case "crawl-delay":
+			inRules = true
+			if seconds, err := strconv.ParseFloat(value, 64); current != nil && err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		case "sitemap":
+			if len(value) > 0 {
+				sitemaps = append(sitemaps, value)
+			}
+		}
+	}
+
+	agent = strings.ToLower(agent)
+	matched := &robotsRules{sitemaps: sitemaps}
+	for _, name := range []string{agent, "*"} {
+		found := false
+		for _, g := range groups {
+			for _, a := range g.agents {
+				if a == name {
+					found = true
+					matched.rules = append(matched.rules, g.rules...)
+					if g.crawlDelay > matched.crawlDelay {
+						matched.crawlDelay = g.crawlDelay
+					}
+					break
+				}
+			}
+		}
+		if found {
+			break
+		}
+	}
+	if matched.crawlDelay > maxCrawlDelay {
+		matched.crawlDelay = maxCrawlDelay
+	}
+	return matched
+}
+
+//allowed reports whether the rules allow `path`, which includes any
+//query. The longest matching rule decides, and allow rules win ties.
+func (rr *robotsRules) allowed(path string) bool {
+	if path == "/robots.txt" {
+		return true
+	}
+	allowed := true
+	longest := -1
+	for _, rule := range rr.rules {
+		if !rule.match.MatchString(path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed = rule.allow
+			longest = len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+//compileRobotsPattern compiles a rule's pattern to a regular expression
+//matching the paths it applies to. A pattern matches the start of a
+//path, "*" matches any characters, and a final "$" matches the end.
+func compileRobotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+//robotsCache caches the robots.txt rules of each site,
+//and when the next request to each site may start.
+type robotsCache struct {
+	mu    sync.Mutex
+	sites map[string]*robotsSite
+}
+
+//robotsSite is the cached robots.txt of a site.
+type robotsSite struct {
+	//mu guards the fields below, but isn't held while fetching the rules
+	mu      sync.Mutex
+	rules   *robotsRules
+	expires time.Time
+	//fetching is closed once the rules being fetched are stored, so that
+	//each site's file is only fetched once. It is nil if they aren't
+	//being fetched.
+	fetching chan struct{}
+	//next is when the next request may start,
+	//going by the site's crawl delay
+	next time.Time
+	//users is the number of requests using the entry, which keeps it
+	//from being evicted. It is guarded by the robotsCache's mu.
+	users int
+}
+
+//site returns the cache entry for the site with `origin`, such as
+//"https://example.com". Once there are maxTrackedHosts sites, unused
+//sites whose rules have expired are evicted, or if there are none,
+//the unused site whose rules expire first. The caller must call done
+//when it is finished with the entry.
+func (rc *robotsCache) site(origin string) *robotsSite {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.sites == nil {
+		rc.sites = map[string]*robotsSite{}
+	}
+	site := rc.sites[origin]
+	if site == nil {
+		if len(rc.sites) >= maxTrackedHosts {
+			rc.evict(time.Now())
+		}
+		site = &robotsSite{}
+		rc.sites[origin] = site
+	}
+	site.users++
+	return site
+}
+
+//done releases an entry returned by site.
+func (rc *robotsCache) done(site *robotsSite) {
+	rc.mu.Lock()
+	site.users--
+	rc.mu.Unlock()
+}
+
+//evict removes the unused sites whose rules have expired and whose
+//crawl delay has passed, or if there are none, the unused site whose
+//rules expire first. The caller must hold rc.mu.
+func (rc *robotsCache) evict(now time.Time) {
+	var oldestKey string
+	var oldest *robotsSite
+	for k, site := range rc.sites {
+		if site.users > 0 {
+			continue
+		}
+		//users is zero, so nothing else holds or will take site.mu
+		if now.After(site.expires) && now.After(site.next) {
+			delete(rc.sites, k)
+		} else if oldest == nil || site.expires.Before(oldest.expires) {
+			oldestKey, oldest = k, site
+		}
+	}
+	if len(rc.sites) >= maxTrackedHosts && oldest != nil {
+		delete(rc.sites, oldestKey)
+	}
+}
+
+//userAgent returns the effective UserAgent of the fetcher.
+func (f *Fetcher) userAgent() string {
+	if len(f.UserAgent) == 0 {
+		return DefaultUserAgent
+	}
+	return f.UserAgent
+}
+
+//robotsAgent returns the product token of the fetcher's user agent,
+//which robots.txt rules are matched against.
+func (f *Fetcher) robotsAgent() string {
+	return strings.TrimSpace(strings.SplitN(f.userAgent(), "/", 2)[0])
+}
+
+//checkRobots returns ErrDisallowed if the fetcher's RobotsMode applies
+//to `ctx` and the site's robots.txt disallows `u`. Otherwise it waits
+//for the site's crawl delay, if it has one, and returns nil.
+func (f *Fetcher) checkRobots(ctx context.Context, u *url.URL) error {
+	switch f.Robots {
+	case RobotsNever:
+		return nil
+	case RobotsBatch:
+		if !isBatch(ctx) {
+			return nil
+		}
+	}
+	site, rules, err := f.robotsRules(ctx, u)
+	if err != nil {
+		return err
+	}
+	defer f.robotsCache.done(site)
+	if !rules.allowed(u.EscapedPath() + querySuffix(u)) {
+		return fmt.Errorf("%s: %w", u, ErrDisallowed)
+	}
+	if rules.crawlDelay <= 0 {
+		return nil
+	}
+	//reserve the next start time, then wait for it
+	site.mu.Lock()
+	start := time.Now()
+	if site.next.After(start) {
+		start = site.next
+	}
+	site.next = start.Add(rules.crawlDelay)
+	site.mu.Unlock()
+	if wait := time.Until(start); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+//querySuffix returns the query of `u` with its "?", if it has one.
+func querySuffix(u *url.URL) string {
+	if len(u.RawQuery) == 0 {
+		return ""
+	}
+	return "?" + u.RawQuery
+}
+
+//robotsRules returns the cached robots.txt rules of the site of `u`,
+//fetching them if they aren't cached or have expired, or waiting for
+//them if another request is already fetching them. If the rules can't
+//be fetched because of `ctx` or the fetcher's limits on requests to the
+//host, an error is returned along with rules disallowing everything.
+//Otherwise, the caller must call f.robotsCache.done with the returned
+//site when it is finished with it.
+func (f *Fetcher) robotsRules(ctx context.Context, u *url.URL) (*robotsSite, *robotsRules, error) {
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+	site := f.robotsCache.site(origin)
+	site.mu.Lock()
+	for site.rules == nil || time.Now().After(site.expires) {
+		if site.fetching == nil {
+			return f.fetchSiteRobots(ctx, site, origin)
+		}
+		fetching := site.fetching
+		site.mu.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			f.robotsCache.done(site)
+			return nil, disallowAll, ctx.Err()
+		}
+		//the fetch may have failed, in which case this request fetches them
+		site.mu.Lock()
+	}
+	rules := site.rules
+	site.mu.Unlock()
+	return site, rules, nil
+}
+
+//fetchSiteRobots fetches and stores the robots.txt rules of `site`,
+//which has `origin`, for robotsRules. The caller must hold site.mu,
+//which is released while fetching, and is unlocked on return.
+func (f *Fetcher) fetchSiteRobots(ctx context.Context, site *robotsSite, origin string) (*robotsSite, *robotsRules, error) {
+	fetching := make(chan struct{})
+	site.fetching = fetching
+	site.mu.Unlock()
+	rules, ttl, err := f.fetchRobots(ctx, origin)
+	site.mu.Lock()
+	if err == nil {
+		site.rules = rules
+		site.expires = time.Now().Add(ttl)
+	}
+	site.fetching = nil
+	site.mu.Unlock()
+	close(fetching)
+	if err != nil {
+		f.robotsCache.done(site)
+		return nil, disallowAll, err
+	}
+	return site, rules, nil
+}
+
+//fetchRobots fetches and parses the robots.txt of the site with
+//`origin`, under the limits and circuit breaker of its host, and
+//returns its rules and how long to cache them for. As RFC 9309 says,
+//a missing file allows everything, while a file that can't be fetched
+//because of a server error, or because the server is limiting our
+//requests with 429 Too Many Requests, disallows everything. Failures that were
+//our own doing, such as the context being done or the host's circuit
+//breaker being open, aren't cached, and are returned as errors.
+func (f *Fetcher) fetchRobots(ctx context.Context, origin string) (*robotsRules, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", origin+"/robots.txt", nil)
+	if err != nil {
+		return disallowAll, robotsErrorTTL, nil
+	}
+	req.Header.Set("User-Agent", f.userAgent())
+	page, err := f.fetchOnce(ctx, req, f.maxBytes())
+	var se *statusError
+	switch {
+	case ctx.Err() != nil:
+		return nil, 0, ctx.Err()
+	case errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrHostBusy):
+		return nil, 0, err
+	case errors.As(err, &se) && se.code < 500 && se.code != http.StatusTooManyRequests:
+		return &robotsRules{}, robotsTTL, nil
+	case err != nil:
+		return disallowAll, robotsErrorTTL, nil
+	}
+	defer page.Body.Close()
+	return parseRobots(io.LimitReader(page.Body, maxRobotsBytes), f.robotsAgent()), robotsTTL, nil
+}
@@ -0,0 +1,279 @@
+package summary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	const robots = `# comments are ignored
+User-agent: *
+Disallow: /
+
+User-agent: OtherBot
+User-agent: summarybot/2.0
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search*q=
+Allow: /page
+Disallow: /page
+Crawl-delay: 1.5
+
+Sitemap: https://test.com/sitemap.xml
+`
+	rules := parseRobots(strings.NewReader(robots), "SummaryBot")
+	cases := []struct {
+		path     string
+		expected bool
+	}{
+		{"/", true},
+		{"/private", false},
+		{"/private/notes", false},
+		{"/private/public/notes", true},
+		{"/files/report.pdf", false},
+		{"/files/report.pdf?download=1", true},
+		{"/search?lang=en&q=go", false},
+		{"/search", true},
+		{"/page", true},
+		{"/robots.txt", true},
+	}
+	for _, c := range cases {
+		if actual := rules.allowed(c.path); actual != c.expected {
+			t.Errorf("path %q: expected allowed to be %t but got %t", c.path, c.expected, actual)
+		}
+	}
+	if rules.crawlDelay != 1500*time.Millisecond {
+		t.Errorf("expected a crawl delay of 1.5s but got %v", rules.crawlDelay)
+	}
+	if expected := []string{"https://test.com/sitemap.xml"}; !reflect.DeepEqual(rules.sitemaps, expected) {
+		t.Errorf("expected sitemaps %v but got %v", expected, rules.sitemaps)
+	}
+
+	if rules := parseRobots(strings.NewReader(robots), "AnotherBot"); rules.allowed("/page") {
+		t.Errorf("expected agents without their own group to follow the * group")
+	}
+	if rules := parseRobots(strings.NewReader("User-agent: SummaryBot\nDisallow:\n\nUser-agent: *\nDisallow: /\n"), "SummaryBot"); !rules.allowed("/page") {
+		t.Errorf("expected an empty group for the agent to allow everything, rather than falling back to *")
+	}
+}
+
+func TestFetcherRobots(t *testing.T) {
+	var robotsRequests int32
+	var userAgent atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent.Store(r.UserAgent())
+		if r.URL.Path == "/robots.txt" {
+			atomic.AddInt32(&robotsRequests, 1)
+			w.Write([]byte("User-agent: SummaryBot\nDisallow: /private\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>Page</title></head></html>"))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		name        string
+		hint        string
+		mode        RobotsMode
+		batch       bool
+		path        string
+		expectError bool
+	}{
+		{
+			"Always Disallowed",
+			"in the always mode, every request should obey robots.txt",
+			RobotsAlways,
+			false,
+			"/private",
+			true,
+		},
+		{
+			"Always Allowed",
+			"paths robots.txt allows should be fetched",
+			RobotsAlways,
+			false,
+			"/public",
+			false,
+		},
+		{
+			"Batch Mode, User Request",
+			"in the batch mode, requests on behalf of a user should ignore robots.txt",
+			RobotsBatch,
+			false,
+			"/private",
+			false,
+		},
+		{
+			"Batch Mode, Batch Request",
+			"in the batch mode, batch requests should obey robots.txt",
+			RobotsBatch,
+			true,
+			"/private",
+			true,
+		},
+		{
+			"Never",
+			"in the never mode, robots.txt should be ignored",
+			RobotsNever,
+			true,
+			"/private",
+			false,
+		},
+	}
+
+	f := newTestFetcher()
+	for _, c := range cases {
+		f.Robots = c.mode
+		ctx := context.Background()
+		if c.batch {
+			ctx = WithBatch(ctx)
+		}
+		_, err := f.Summarize(ctx, server.URL+c.path)
+		if c.expectError && !errors.Is(err, ErrDisallowed) {
+			t.Errorf("case %s: expected ErrDisallowed but got %v\nHINT: %s", c.name, err, c.hint)
+		}
+		if !c.expectError && err != nil {
+			t.Errorf("case %s: unexpected error %v\nHINT: %s", c.name, err, c.hint)
+		}
+	}
+	if n := atomic.LoadInt32(&robotsRequests); n != 1 {
+		t.Errorf("expected robots.txt to be fetched once and cached, but it was fetched %d times", n)
+	}
+	if ua, _ := userAgent.Load().(string); ua != DefaultUserAgent {
+		t.Errorf("expected the default user agent %q but got %q", DefaultUserAgent, ua)
+	}
+}
+
+func TestFetcherRobotsUnavailable(t *testing.T) {
+	for _, status := range []int{http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.Error(w, "unavailable", status)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><head><title>Page</title></head></html>"))
+		}))
+
+		f := newTestFetcher()
+		f.Robots = RobotsAlways
+		if _, err := f.Summarize(context.Background(), server.URL+"/page"); !errors.Is(err, ErrDisallowed) {
+			t.Errorf("expected a site whose robots.txt has status code %d to be disallowed, but got %v", status, err)
+		}
+		server.Close()
+	}
+}
+
+func TestFetcherRobotsWait(t *testing.T) {
+	fetching := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			close(fetching)
+			<-release
+			return
+		}
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	f := newTestFetcher()
+	f.Robots = RobotsAlways
+	done := make(chan error)
+	go func() {
+		_, err := f.Fetch(context.Background(), server.URL+"/first")
+		done <- err
+	}()
+	<-fetching
+
+	//a request waiting for another's robots.txt fetch gives up with its context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	timer := time.AfterFunc(time.Second, func() { close(release) })
+	start := time.Now()
+	if _, err := f.Fetch(ctx, server.URL+"/second"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the waiting request to stop at its deadline, but it took %v", elapsed)
+	}
+	if timer.Stop() {
+		close(release)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error fetching the first page: %v", err)
+	}
+}
+
+func TestFetcherRobotsBreaker(t *testing.T) {
+	var robotsRequests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			atomic.AddInt32(&robotsRequests, 1)
+			return
+		}
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	f := newTestFetcher()
+	f.BreakerThreshold = 1
+	f.Robots = RobotsNever
+	if _, err := f.Fetch(ctx, server.URL+"/page"); err == nil {
+		t.Fatalf("expected the request to fail")
+	}
+	//robots.txt is fetched under the host's open breaker,
+	//which isn't mistaken for the site disallowing everything
+	f.Robots = RobotsAlways
+	if _, err := f.Fetch(ctx, server.URL+"/page"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen but got %v", err)
+	}
+	if n := atomic.LoadInt32(&robotsRequests); n != 0 {
+		t.Errorf("expected robots.txt not to be requested while the breaker is open, but it was requested %d times", n)
+	}
+}
+
+func TestRobotsCacheEviction(t *testing.T) {
+	rc := &robotsCache{}
+	now := time.Now()
+	//one site in use, and the rest unused, with the first to expire in use
+	inUse := rc.site("https://0.test")
+	inUse.expires = now.Add(time.Minute)
+	for i := 1; i < maxTrackedHosts; i++ {
+		site := rc.site(fmt.Sprintf("https://%d.test", i))
+		site.expires = now.Add(time.Hour + time.Duration(i)*time.Second)
+		rc.done(site)
+	}
+	rc.done(rc.site("https://new.test"))
+	if len(rc.sites) != maxTrackedHosts {
+		t.Errorf("expected %d sites but got %d", maxTrackedHosts, len(rc.sites))
+	}
+	if rc.sites["https://0.test"] != inUse {
+		t.Errorf("expected the site in use to be kept")
+	}
+	if rc.sites["https://1.test"] != nil {
+		t.Errorf("expected the unused site whose rules expire first to be evicted")
+	}
+
+	//expired sites are all evicted
+	for origin, site := range rc.sites {
+		if origin != "https://0.test" {
+			site.expires = now.Add(-time.Minute)
+		}
+	}
+	rc.done(rc.site("https://other.test"))
+	if len(rc.sites) != 2 || rc.sites["https://0.test"] != inUse {
+		t.Errorf("expected the expired sites to be evicted, but got %d sites", len(rc.sites))
+	}
+}
@@ -0,0 +1,264 @@
+package summary
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//RuleSet is a set of site-specific extraction rules, for sites whose
+//meta-data is missing or poor. It is normally read from a JSON file:
+//
+//  {
+//    "rules": [
+//      {
+//        "hosts": ["github.com", "*.github.io"],
+//        "title": "strong[itemprop=name] a",
+//        "description": {"selector": "meta[name=description]", "attr": "content"},
+//        "image": {"selector": "img.avatar", "attr": "src"},
+//        "author": "a[rel=author]"
+//      }
+//    ]
+//  }
+//
+//Each field is a CSS selector, whose first matching element's text
+//is used, or an object with a selector and the attribute to read.
+//For the image, every matching element is used.
+type RuleSet struct {
+	Rules []*SiteRule `json:"rules"`
+}
+
+//SiteRule says how to extract fields from the pages of some hosts.
+type SiteRule struct {
+	//Hosts are the host names the rule applies to. A pattern starting
+	//with "*." matches any subdomain, but not the domain itself.
+	Hosts       []string   `json:"hosts"`
+	Title       *FieldRule `json:"title,omitempty"`
+	Description *FieldRule `json:"description,omitempty"`
+	Author      *FieldRule `json:"author,omitempty"`
+	Image       *FieldRule `json:"image,omitempty"`
+}
+
+//FieldRule finds values in a document with a CSS selector. Each value
+//is the text of a matching element, or the value of its Attr attribute.
+//FieldRules find the fields of a SiteRule, and answer the ad-hoc
+//queries in Options.Queries.
+type FieldRule struct {
+	Selector string `json:"selector"`
+	Attr     string `json:"attr,omitempty"`
+	compiled *Selector
+}
+
+//NewFieldRule returns a rule that finds the text of the elements
+//matching `selector`, or their `attr` attribute if it isn't empty.
+func NewFieldRule(selector string, attr string) (*FieldRule, error) {
+	compiled, err := CompileSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	return &FieldRule{Selector: selector, Attr: strings.ToLower(attr), compiled: compiled}, nil
+}
+
+//UnmarshalJSON reads a FieldRule from either a selector string or
+//an object, and compiles its selector.
+func (fr *FieldRule) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		fr.Attr = ""
+		if err := json.Unmarshal(data, &fr.Selector); err != nil {
+			return err
+		}
+	} else {
+		//an alias type doesn't have this method, so this doesn't recurse
+		type fieldRule FieldRule
+		if err := json.Unmarshal(data, (*fieldRule)(fr)); err != nil {
+			return err
+		}
+	}
+	compiled, err := CompileSelector(fr.Selector)
+	if err != nil {
+		return err
+	}
+	fr.compiled = compiled
+	fr.Attr = strings.ToLower(fr.Attr)
+	return nil
+}
+
+//Complexity returns the complexity of the rule's selector.
+func (fr *FieldRule) Complexity() int {
+	return fr.compiled.Complexity()
+}
+
+//Values returns the non-empty values the rule finds in `doc`,
+//in document order.
+func (fr *FieldRule) Values(doc *Document) []string {
+	var values []string
+	for _, n := range doc.Select(fr.compiled) {
+		value := Text(n)
+		if len(fr.Attr) > 0 {
+			value = strings.TrimSpace(Attr(n, fr.Attr))
+		}
+		if len(value) > 0 {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+//tag describes the rule for provenance.
+func (fr *FieldRule) tag() string {
+	if len(fr.Attr) > 0 {
+		return fr.Selector + " @" + fr.Attr
+	}
+	return fr.Selector
+}
+
+//ParseRuleSet parses and validates a JSON rule set.
+func ParseRuleSet(data []byte) (*RuleSet, error) {
+	rs := &RuleSet{}
+	if err := json.Unmarshal(data, rs); err != nil {
+		return nil, err
+	}
+	for i, rule := range rs.Rules {
+		if len(rule.Hosts) == 0 {
+			return nil, fmt.Errorf("rule %d has no hosts", i+1)
+		}
+		for _, field := range []*FieldRule{rule.Title, rule.Description, rule.Author, rule.Image} {
+			if field != nil && field.compiled == nil {
+				return nil, fmt.Errorf("rule %d has a field with no selector", i+1)
+			}
+		}
+	}
+	return rs, nil
+}
+
+//Match returns the first rule that applies to `host`, or nil.
+func (rs *RuleSet) Match(host string) *SiteRule {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, rule := range rs.Rules {
+		for _, pattern := range rule.Hosts {
+			pattern = strings.ToLower(pattern)
+			if pattern == host ||
+				(strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:])) {
+				return rule
+			}
+		}
+	}
+	return nil
+}
+
+//Extract adds the fields the rule for the document's host finds.
+func (rs *RuleSet) Extract(doc *Document, c *Candidates) {
+	u, err := url.Parse(doc.URL)
+	if err != nil {
+		return
+	}
+	rule := rs.Match(u.Hostname())
+	if rule == nil {
+		return
+	}
+	for field, fr := range map[Field]*FieldRule{
+		FieldTitle:       rule.Title,
+		FieldDescription: rule.Description,
+		FieldAuthor:      rule.Author,
+		FieldImages:      rule.Image,
+	} {
+		if fr == nil {
+			continue
+		}
+		for _, value := range fr.Values(doc) {
+			if field == FieldImages {
+				c.AddImage(field, &PreviewImage{URL: doc.ResolveURL(value)}, fr.tag())
+			} else {
+				c.Add(field, value, fr.tag())
+			}
+		}
+	}
+}
+
+//RulesFile is an Extractor that applies the rule set in a JSON file,
+//which can be reloaded when the file changes. It is named "rules".
+type RulesFile struct {
+	path    string
+	mu      sync.RWMutex
+	rules   *RuleSet
+	modTime time.Time
+	size    int64
+}
+
+//LoadRulesFile reads the rule set in the file at `path`.
+func LoadRulesFile(path string) (*RulesFile, error) {
+	rf := &RulesFile{path: path}
+	if _, err := rf.Reload(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+//Name returns "rules".
+func (rf *RulesFile) Name() string { return "rules" }
+
+//Extract applies the current rule set to `doc`.
+func (rf *RulesFile) Extract(doc *Document, c *Candidates) {
+	rf.mu.RLock()
+	rules := rf.rules
+	rf.mu.RUnlock()
+	rules.Extract(doc, c)
+}
+
+//Reload reads the file again if its modification time or size has
+//changed, and reports whether it did. If the new file can't be read
+//or is invalid, an error is returned and the current rules are kept.
+func (rf *RulesFile) Reload() (bool, error) {
+	info, err := os.Stat(rf.path)
+	if err != nil {
+		return false, err
+	}
+	rf.mu.RLock()
+	unchanged := rf.rules != nil && info.ModTime().Equal(rf.modTime) && info.Size() == rf.size
+	rf.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(rf.path)
+	if err != nil {
+		return false, err
+	}
+	rules, err := ParseRuleSet(data)
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	//remember the file even if it is invalid,
+	//so the error isn't reported again until it changes
+	rf.modTime = info.ModTime()
+	rf.size = info.Size()
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", rf.path, err)
+	}
+	rf.rules = rules
+	return true, nil
+}
+
+//Watch checks the file for changes every `interval` until `ctx` is done,
+//reloading it when it changes. Errors, such as an invalid new file, are
+//passed to `onError`, and the current rules are kept until the file
+//is fixed.
+func (rf *RulesFile) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := rf.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package summary
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRuleSet(t *testing.T) {
+	rules, err := ParseRuleSet([]byte(`{
+		"rules": [
+			{
+				"hosts": ["wiki.test.com", "*.tracker.test"],
+				"title": "h1#page-title",
+				"author": {"selector": "a.author", "attr": "title"},
+				"image": {"selector": ".avatar img", "attr": "src"}
+			}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error parsing rules: %v", err)
+	}
+	const page = `<html><head><title>Wiki</title><meta property="og:title" content="Wiki"></head><body>
+		<h1 id="page-title">  Release Checklist </h1>
+		<a class="author" title="Test Author" href="/users/1">tauthor</a>
+		<div class="avatar"><img src="/avatars/1.png"></div>
+		</body></html>`
+
+	cases := []struct {
+		name            string
+		hint            string
+		pageURL         string
+		expectedSummary *PageSummary
+	}{
+		{
+			"Matching Host",
+			"rules should override generic values for the hosts they match",
+			"http://wiki.test.com/pages/1",
+			&PageSummary{
+				Title:  "Release Checklist",
+				Author: "Test Author",
+				Images: []*PreviewImage{{URL: "http://wiki.test.com/avatars/1.png"}},
+			},
+		},
+		{
+			"Wildcard Host",
+			"*. patterns should match subdomains",
+			"https://JIRA.tracker.test/browse/T-1",
+			&PageSummary{
+				Title:  "Release Checklist",
+				Author: "Test Author",
+				Images: []*PreviewImage{{URL: "https://JIRA.tracker.test/avatars/1.png"}},
+			},
+		},
+		{
+			"Other Host",
+			"rules shouldn't apply to other hosts",
+			"http://tracker.test/",
+			&PageSummary{Title: "Wiki"},
+		},
+	}
+
+	registry := DefaultRegistry()
+	if err := registry.RegisterBefore("opengraph", NewExtractor("rules", rules.Extract)); err != nil {
+		t.Fatalf("unexpected error registering rules: %v", err)
+	}
+	for _, c := range cases {
+		summary, err := Extract(context.Background(), strings.NewReader(page), c.pageURL, &Options{Registry: registry})
+		if err != nil {
+			t.Errorf("case %s: unexpected error %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(summary, c.expectedSummary) {
+			expectedJSON, _ := json.MarshalIndent(c.expectedSummary, "", "  ")
+			actualJSON, _ := json.MarshalIndent(summary, "", "  ")
+			t.Errorf("case %s: incorrect result:\nEXPECTED: %s\nACTUAL: %s\nHINT: %s",
+				c.name, string(expectedJSON), string(actualJSON), c.hint)
+		}
+	}
+
+	for _, invalid := range []string{
+		`{"rules": [{"title": "h1"}]}`,
+		`{"rules": [{"hosts": ["test.com"], "title": "h1["}]}`,
+		`{"rules": [{"hosts": ["test.com"], "title": {"attr": "content"}}]}`,
+		`{"rules": `,
+	} {
+		if _, err := ParseRuleSet([]byte(invalid)); err == nil {
+			t.Errorf("expected an error parsing %s", invalid)
+		}
+	}
+}
+
+func TestRulesFileReload(t *testing.T) {
+	dir, err := os.MkdirTemp("", "rules")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rules.json")
+	write := func(title string, modTime time.Time) {
+		data := `{"rules": [{"hosts": ["test.com"], "title": "` + title + `"}]}`
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("error writing rules: %v", err)
+		}
+		//set the modification time explicitly, since writes
+		//in quick succession may not change it
+		os.Chtimes(path, modTime, modTime)
+	}
+	extractTitle := func(rf *RulesFile) string {
+		const page = `<html><body><h1>Heading</h1><h2>Subheading</h2></body></html>`
+		summary, err := Extract(context.Background(), strings.NewReader(page), "http://test.com/",
+			&Options{Registry: NewRegistry(rf)})
+		if err != nil {
+			t.Fatalf("unexpected error extracting: %v", err)
+		}
+		return summary.Title
+	}
+
+	start := time.Now().Add(-time.Hour)
+	write("h1", start)
+	rf, err := LoadRulesFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error loading rules: %v", err)
+	}
+	if title := extractTitle(rf); title != "Heading" {
+		t.Errorf("expected title %q but got %q", "Heading", title)
+	}
+
+	if reloaded, err := rf.Reload(); reloaded || err != nil {
+		t.Errorf("expected an unchanged file not to be reloaded, but got %t, %v", reloaded, err)
+	}
+
+	write("h2", start.Add(time.Minute))
+	if reloaded, err := rf.Reload(); !reloaded || err != nil {
+		t.Errorf("expected a changed file to be reloaded, but got %t, %v", reloaded, err)
+	}
+	if title := extractTitle(rf); title != "Subheading" {
+		t.Errorf("expected title %q after reloading but got %q", "Subheading", title)
+	}
+
+	write("h2[", start.Add(2*time.Minute))
+	if _, err := rf.Reload(); err == nil {
+		t.Errorf("expected an error reloading an invalid file")
+	}
+	if title := extractTitle(rf); title != "Subheading" {
+		t.Errorf("expected the previous rules to be kept after an invalid reload, but got title %q", title)
+	}
+	if _, err := rf.Reload(); err != nil {
+		t.Errorf("expected an invalid file not to be reported again until it changes, but got %v", err)
+	}
+
+	if _, err := LoadRulesFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("expected an error loading a missing file")
+	}
+}
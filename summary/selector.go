@@ -0,0 +1,648 @@
+package summary
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+//Selector is a compiled CSS selector, which can find elements in a parsed
+//HTML document. It supports the commonly used parts of CSS Selectors
+//Level 3:
+//
+//  - type (div), universal (*), id (#main) and class (.title) selectors
+//  - attribute selectors: [attr], [attr=v], [attr~=v], [attr|=v],
+//    [attr^=v], [attr$=v] and [attr*=v], with an optional i flag
+//    for case-insensitive values
+//  - the :first-child, :last-child, :only-child, :first-of-type,
+//    :last-of-type, :nth-child(), :nth-last-child(), :nth-of-type()
+//    and :not() pseudo-classes
+//  - descendant ( ), child (>), adjacent sibling (+) and general
+//    sibling (~) combinators, and comma-separated selector lists
+type Selector struct {
+	source string
+	groups []*complexSelector
+}
+
+//complexSelector is a chain of compound selectors joined by combinators.
+type complexSelector struct {
+	//compounds[i].combinator joins compounds[i-1] to compounds[i]
+	compounds []*compoundSelector
+}
+
+//compoundSelector is a sequence of simple selectors
+//that must all match the same element.
+type compoundSelector struct {
+	combinator byte
+	simple     []simpleSelector
+}
+
+//simpleSelector matches a single condition on an element.
+type simpleSelector interface {
+	match(n *html.Node) bool
+}
+
+//CompileSelector parses a CSS selector. An error is returned if the
+//selector is invalid or uses features that aren't supported.
+func CompileSelector(s string) (*Selector, error) {
+	p := &selectorParser{s: s}
+	groups, err := p.parseList()
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %v", s, err)
+	}
+	return &Selector{source: s, groups: groups}, nil
+}
+
+//MustCompileSelector is like CompileSelector but panics if the
+//selector is invalid. It is meant for selectors known at compile time.
+func MustCompileSelector(s string) *Selector {
+	sel, err := CompileSelector(s)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+//String returns the source text of the selector.
+func (sel *Selector) String() string {
+	return sel.source
+}
+
+//Complexity returns the number of simple selectors and combinators in
+//the selector, which bounds how much work matching an element can take.
+func (sel *Selector) Complexity() int {
+	n := 0
+	for _, group := range sel.groups {
+		for i, compound := range group.compounds {
+			if i > 0 {
+				n++
+			}
+			for _, simple := range compound.simple {
+				n++
+				if not, ok := simple.(*notSelector); ok {
+					n += len(not.simple) - 1
+				}
+			}
+		}
+	}
+	return n
+}
+
+//Match reports whether the element `n` matches the selector.
+func (sel *Selector) Match(n *html.Node) bool {
+	return sel.match(newSelectorMatch(context.Background()), n)
+}
+
+func (sel *Selector) match(m *selectorMatch, n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, group := range sel.groups {
+		if m.match(group, n, len(group.compounds)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+//MatchAll returns the elements within `root` that match the
+//selector, in document order.
+func (sel *Selector) MatchAll(root *html.Node) []*html.Node {
+	matches, _ := sel.MatchAllContext(context.Background(), root)
+	return matches
+}
+
+//MatchAllContext is like MatchAll, but stops and returns ctx.Err()
+//if `ctx` is done before it finishes.
+func (sel *Selector) MatchAllContext(ctx context.Context, root *html.Node) ([]*html.Node, error) {
+	m := newSelectorMatch(ctx)
+	var matches []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if sel.match(m, n) {
+			matches = append(matches, n)
+		}
+		for child := n.FirstChild; child != nil && m.err == nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(root)
+	if m.err != nil {
+		return nil, m.err
+	}
+	return matches, nil
+}
+
+//Select returns the elements of the document that match `sel`,
+//or none if the document's context is done before they are found.
+func (doc *Document) Select(sel *Selector) []*html.Node {
+	matches, _ := sel.MatchAllContext(doc.context(), doc.Root)
+	return matches
+}
+
+//selectorCheckInterval is how many elements are matched
+//between checks of whether the context is done.
+const selectorCheckInterval = 1024
+
+//selectorMatch is the state of matching a selector against the elements
+//of a document. Whether an element matches the compound selectors up to
+//an index doesn't depend on where matching started, so the elements that
+//don't are remembered, and backtracking through the descendant and
+//general sibling combinators never checks the same element twice. This
+//keeps matching linear in the size of the document, for each compound
+//selector and combinator, rather than exponential.
+type selectorMatch struct {
+	ctx    context.Context
+	failed map[selectorMatchKey]bool
+	steps  int
+	//err is the context's error, once it is done
+	err error
+}
+
+//selectorMatchKey identifies the compound selectors
+//of `cs` up to index `i`, matched against `n`.
+type selectorMatchKey struct {
+	cs *complexSelector
+	n  *html.Node
+	i  int
+}
+
+func newSelectorMatch(ctx context.Context) *selectorMatch {
+	return &selectorMatch{ctx: ctx, failed: map[selectorMatchKey]bool{}}
+}
+
+//match reports whether `n` matches the compound selectors of `cs` up to
+//and including index `i`, checking them from right to left. Once the
+//context is done, nothing matches.
+func (m *selectorMatch) match(cs *complexSelector, n *html.Node, i int) bool {
+	if m.err != nil {
+		return false
+	}
+	if m.steps%selectorCheckInterval == 0 {
+		if m.err = m.ctx.Err(); m.err != nil {
+			return false
+		}
+	}
+	m.steps++
+	compound := cs.compounds[i]
+	if !compound.match(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	key := selectorMatchKey{cs, n, i}
+	if m.failed[key] {
+		return false
+	}
+	matched := false
+	switch compound.combinator {
+	case '>':
+		parent := n.Parent
+		matched = parent != nil && parent.Type == html.ElementNode && m.match(cs, parent, i-1)
+	case '+':
+		prev := previousElement(n)
+		matched = prev != nil && m.match(cs, prev, i-1)
+	case '~':
+		for prev := previousElement(n); prev != nil && !matched; prev = previousElement(prev) {
+			matched = m.match(cs, prev, i-1)
+		}
+	default:
+		for a := n.Parent; a != nil && a.Type == html.ElementNode && !matched; a = a.Parent {
+			matched = m.match(cs, a, i-1)
+		}
+	}
+	if !matched && m.err == nil {
+		m.failed[key] = true
+	}
+	return matched
+}
+
+func (c *compoundSelector) match(n *html.Node) bool {
+	for _, simple := range c.simple {
+		if !simple.match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+//previousElement returns the element before `n` among its siblings.
+func previousElement(n *html.Node) *html.Node {
+	for prev := n.PrevSibling; prev != nil; prev = prev.PrevSibling {
+		if prev.Type == html.ElementNode {
+			return prev
+		}
+	}
+	return nil
+}
+
+//typeSelector matches elements by tag name.
+type typeSelector string
+
+func (s typeSelector) match(n *html.Node) bool {
+	return strings.EqualFold(n.Data, string(s))
+}
+
+//universalSelector matches any element.
+type universalSelector struct{}
+
+func (universalSelector) match(n *html.Node) bool { return true }
+
+//attrSelector matches elements by attribute, which is also how
+//id and class selectors are implemented.
+type attrSelector struct {
+	key        string
+	op         string
+	value      string
+	ignoreCase bool
+}
+
+func (s *attrSelector) match(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if a.Key == s.key && len(a.Namespace) == 0 {
+			return s.matchValue(a.Val)
+		}
+	}
+	return false
+}
+
+func (s *attrSelector) matchValue(v string) bool {
+	want := s.value
+	if s.ignoreCase {
+		v, want = strings.ToLower(v), strings.ToLower(want)
+	}
+	switch s.op {
+	case "":
+		return true
+	case "=":
+		return v == want
+	case "~=":
+		for _, word := range strings.Fields(v) {
+			if word == want {
+				return true
+			}
+		}
+		return false
+	case "|=":
+		return v == want || strings.HasPrefix(v, want+"-")
+	case "^=":
+		return len(want) > 0 && strings.HasPrefix(v, want)
+	case "$=":
+		return len(want) > 0 && strings.HasSuffix(v, want)
+	case "*=":
+		return len(want) > 0 && strings.Contains(v, want)
+	}
+	return false
+}
+
+//nthSelector implements the structural pseudo-classes, matching
+//elements whose position among their siblings is a*k+b for some k>=0.
+type nthSelector struct {
+	a, b   int
+	last   bool
+	ofType bool
+}
+
+func (s *nthSelector) match(n *html.Node) bool {
+	if n.Parent == nil {
+		return false
+	}
+	position := 1
+	next := func(sibling *html.Node) *html.Node { return sibling.PrevSibling }
+	if s.last {
+		next = func(sibling *html.Node) *html.Node { return sibling.NextSibling }
+	}
+	for sibling := next(n); sibling != nil; sibling = next(sibling) {
+		if sibling.Type == html.ElementNode && (!s.ofType || sibling.Data == n.Data) {
+			position++
+		}
+	}
+	if s.a == 0 {
+		return position == s.b
+	}
+	k := position - s.b
+	return k%s.a == 0 && k/s.a >= 0
+}
+
+//onlySelector implements :only-child.
+type onlySelector struct{}
+
+func (onlySelector) match(n *html.Node) bool {
+	return (&nthSelector{a: 0, b: 1}).match(n) && (&nthSelector{a: 0, b: 1, last: true}).match(n)
+}
+
+//notSelector implements :not(), matching elements
+//that don't match its compound selector.
+type notSelector struct {
+	compoundSelector
+}
+
+func (s *notSelector) match(n *html.Node) bool {
+	return !s.compoundSelector.match(n)
+}
+
+//selectorParser parses the selector `s`, reading from `pos`.
+type selectorParser struct {
+	s   string
+	pos int
+}
+
+func (p *selectorParser) parseList() ([]*complexSelector, error) {
+	var groups []*complexSelector
+	for {
+		group, err := p.parseComplex()
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+		p.skipSpace()
+		if p.pos == len(p.s) {
+			return groups, nil
+		}
+		if p.s[p.pos] != ',' {
+			return nil, fmt.Errorf("unexpected %q at offset %d", p.s[p.pos], p.pos)
+		}
+		p.pos++
+	}
+}
+
+func (p *selectorParser) parseComplex() (*complexSelector, error) {
+	p.skipSpace()
+	cs := &complexSelector{}
+	var combinator byte
+	for {
+		compound, err := p.parseCompound()
+		if err != nil {
+			return nil, err
+		}
+		compound.combinator = combinator
+		cs.compounds = append(cs.compounds, compound)
+
+		hadSpace := p.skipSpace()
+		if p.pos == len(p.s) || p.s[p.pos] == ',' {
+			return cs, nil
+		}
+		switch c := p.s[p.pos]; c {
+		case '>', '+', '~':
+			combinator = c
+			p.pos++
+			p.skipSpace()
+		default:
+			if !hadSpace {
+				return nil, fmt.Errorf("unexpected %q at offset %d", c, p.pos)
+			}
+			combinator = ' '
+		}
+	}
+}
+
+func (p *selectorParser) parseCompound() (*compoundSelector, error) {
+	compound := &compoundSelector{}
+	if p.pos < len(p.s) && p.s[p.pos] == '*' {
+		p.pos++
+		compound.simple = append(compound.simple, universalSelector{})
+	} else if name := p.parseIdent(); len(name) > 0 {
+		compound.simple = append(compound.simple, typeSelector(name))
+	}
+	for p.pos < len(p.s) {
+		var simple simpleSelector
+		var err error
+		switch p.s[p.pos] {
+		case '#':
+			p.pos++
+			id := p.parseIdent()
+			if len(id) == 0 {
+				return nil, fmt.Errorf("expected an id at offset %d", p.pos)
+			}
+			simple = &attrSelector{key: "id", op: "=", value: id}
+		case '.':
+			p.pos++
+			class := p.parseIdent()
+			if len(class) == 0 {
+				return nil, fmt.Errorf("expected a class name at offset %d", p.pos)
+			}
+			simple = &attrSelector{key: "class", op: "~=", value: class}
+		case '[':
+			simple, err = p.parseAttr()
+		case ':':
+			simple, err = p.parsePseudo()
+		default:
+			if len(compound.simple) == 0 {
+				return nil, fmt.Errorf("expected a selector at offset %d", p.pos)
+			}
+			return compound, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		compound.simple = append(compound.simple, simple)
+	}
+	if len(compound.simple) == 0 {
+		return nil, fmt.Errorf("expected a selector at offset %d", p.pos)
+	}
+	return compound, nil
+}
+
+func (p *selectorParser) parseAttr() (simpleSelector, error) {
+	p.pos++
+	p.skipSpace()
+	key := strings.ToLower(p.parseIdent())
+	if len(key) == 0 {
+		return nil, fmt.Errorf("expected an attribute name at offset %d", p.pos)
+	}
+	s := &attrSelector{key: key}
+	p.skipSpace()
+	if p.pos < len(p.s) && p.s[p.pos] != ']' {
+		for _, op := range []string{"=", "~=", "|=", "^=", "$=", "*="} {
+			if strings.HasPrefix(p.s[p.pos:], op) {
+				s.op = op
+				p.pos += len(op)
+				break
+			}
+		}
+		if len(s.op) == 0 {
+			return nil, fmt.Errorf("expected an attribute operator at offset %d", p.pos)
+		}
+		p.skipSpace()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		s.value = value
+		p.skipSpace()
+		if p.pos < len(p.s) && (p.s[p.pos] == 'i' || p.s[p.pos] == 'I') {
+			s.ignoreCase = true
+			p.pos++
+			p.skipSpace()
+		}
+	}
+	if p.pos == len(p.s) || p.s[p.pos] != ']' {
+		return nil, fmt.Errorf("expected ] at offset %d", p.pos)
+	}
+	p.pos++
+	return s, nil
+}
+
+//parseValue parses an attribute value, which is an identifier or a
+//quoted string.
+func (p *selectorParser) parseValue() (string, error) {
+	if p.pos == len(p.s) {
+		return "", fmt.Errorf("expected an attribute value at offset %d", p.pos)
+	}
+	quote := p.s[p.pos]
+	if quote != '"' && quote != '\'' {
+		value := p.parseIdent()
+		if len(value) == 0 {
+			return "", fmt.Errorf("expected an attribute value at offset %d", p.pos)
+		}
+		return value, nil
+	}
+	p.pos++
+	sb := &strings.Builder{}
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return sb.String(), nil
+		case c == '\\' && p.pos+1 < len(p.s):
+			sb.WriteByte(p.s[p.pos+1])
+			p.pos += 2
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", fmt.Errorf("unterminated string at offset %d", p.pos)
+}
+
+func (p *selectorParser) parsePseudo() (simpleSelector, error) {
+	p.pos++
+	name := strings.ToLower(p.parseIdent())
+	switch name {
+	case "first-child":
+		return &nthSelector{a: 0, b: 1}, nil
+	case "last-child":
+		return &nthSelector{a: 0, b: 1, last: true}, nil
+	case "only-child":
+		return onlySelector{}, nil
+	case "first-of-type":
+		return &nthSelector{a: 0, b: 1, ofType: true}, nil
+	case "last-of-type":
+		return &nthSelector{a: 0, b: 1, last: true, ofType: true}, nil
+	}
+
+	if p.pos == len(p.s) || p.s[p.pos] != '(' {
+		return nil, fmt.Errorf("unsupported pseudo-class :%s", name)
+	}
+	end := strings.IndexByte(p.s[p.pos:], ')')
+	if end < 0 {
+		return nil, fmt.Errorf("expected ) at offset %d", len(p.s))
+	}
+	arg := strings.TrimSpace(p.s[p.pos+1 : p.pos+end])
+	argStart := p.pos + 1
+	p.pos += end + 1
+
+	switch name {
+	case "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
+		a, b, err := parseNth(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &nthSelector{
+			a:      a,
+			b:      b,
+			last:   strings.Contains(name, "last"),
+			ofType: strings.HasSuffix(name, "of-type"),
+		}, nil
+	case "not":
+		inner := &selectorParser{s: arg}
+		compound, err := inner.parseCompound()
+		if err != nil {
+			return nil, err
+		}
+		if inner.pos != len(arg) {
+			return nil, fmt.Errorf("unsupported :not() argument at offset %d", argStart+inner.pos)
+		}
+		return &notSelector{*compound}, nil
+	}
+	return nil, fmt.Errorf("unsupported pseudo-class :%s()", name)
+}
+
+//parseNth parses the an+b argument of the :nth-*() pseudo-classes.
+func parseNth(arg string) (int, int, error) {
+	arg = strings.ToLower(strings.Join(strings.Fields(arg), ""))
+	switch arg {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+	invalid := fmt.Errorf("invalid :nth-*() argument %q", arg)
+	i := strings.IndexByte(arg, 'n')
+	if i < 0 {
+		b, err := strconv.Atoi(arg)
+		if err != nil {
+			return 0, 0, invalid
+		}
+		return 0, b, nil
+	}
+	a := 1
+	switch coefficient := arg[:i]; coefficient {
+	case "", "+":
+	case "-":
+		a = -1
+	default:
+		var err error
+		if a, err = strconv.Atoi(coefficient); err != nil {
+			return 0, 0, invalid
+		}
+	}
+	b := 0
+	if rest := arg[i+1:]; len(rest) > 0 {
+		if rest[0] != '+' && rest[0] != '-' {
+			return 0, 0, invalid
+		}
+		var err error
+		if b, err = strconv.Atoi(rest); err != nil {
+			return 0, 0, invalid
+		}
+	}
+	return a, b, nil
+}
+
+//parseIdent parses a CSS identifier, which may contain backslash
+//escapes, and returns an empty string if there isn't one.
+func (p *selectorParser) parseIdent() string {
+	sb := &strings.Builder{}
+	for p.pos < len(p.s) {
+		r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+		switch {
+		case r == '\\' && p.pos+size < len(p.s):
+			escaped, escapedSize := utf8.DecodeRuneInString(p.s[p.pos+size:])
+			sb.WriteRune(escaped)
+			p.pos += size + escapedSize
+		case r == '-' || r == '_' || r >= utf8.RuneSelf || unicode.IsLetter(r) || unicode.IsDigit(r):
+			sb.WriteRune(r)
+			p.pos += size
+		default:
+			return sb.String()
+		}
+	}
+	return sb.String()
+}
+
+//skipSpace skips white space and reports whether there was any.
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte(" \t\n\r\f", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
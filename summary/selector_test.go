@@ -0,0 +1,115 @@
+package summary
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+func TestSelector(t *testing.T) {
+	const page = `<html><head><title>Test</title></head><body>
+		<div id="main" class="content wide">
+			<h1 class="title">Heading</h1>
+			<p lang="en-US">First</p>
+			<p class="note">Second</p>
+			<p><a href="https://test.com/a.pdf" data-kind="Doc">Third</a></p>
+		</div>
+		<ul><li>one</li><li>two</li><li>three</li><li>four</li></ul>
+		</body></html>`
+	root, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("error parsing page: %v", err)
+	}
+
+	cases := []struct {
+		selector string
+		expected []string
+	}{
+		{"h1", []string{"Heading"}},
+		{"#main > h1.title", []string{"Heading"}},
+		{".content.wide h1", []string{"Heading"}},
+		{"div p", []string{"First", "Second", "Third"}},
+		{"div > a", nil},
+		{"h1 + p", []string{"First"}},
+		{"h1 ~ p", []string{"First", "Second", "Third"}},
+		{"p:not(.note)", []string{"First", "Third"}},
+		{"[lang|=en]", []string{"First"}},
+		{`a[href$=".pdf"]`, []string{"Third"}},
+		{`a[href^='https://']`, []string{"Third"}},
+		{`[data-kind="doc" i]`, []string{"Third"}},
+		{"li:first-child, li:last-child", []string{"one", "four"}},
+		{"li:nth-child(odd)", []string{"one", "three"}},
+		{"li:nth-child(2n)", []string{"two", "four"}},
+		{"li:nth-last-child(-n+2)", []string{"three", "four"}},
+		{"p:nth-of-type(2)", []string{"Second"}},
+		{"ul *:only-child", nil},
+	}
+	for _, c := range cases {
+		sel, err := CompileSelector(c.selector)
+		if err != nil {
+			t.Errorf("selector %q: unexpected error %v", c.selector, err)
+			continue
+		}
+		var actual []string
+		for _, n := range sel.MatchAll(root) {
+			actual = append(actual, Text(n))
+		}
+		if strings.Join(actual, "|") != strings.Join(c.expected, "|") {
+			t.Errorf("selector %q: expected %q but got %q", c.selector, c.expected, actual)
+		}
+	}
+}
+
+func TestSelectorBacktracking(t *testing.T) {
+	//every element is a div with no span above it, so without memoization,
+	//each div would backtrack through every combination of its ancestors
+	page := strings.Repeat("<div>", 200) + strings.Repeat("</div>", 200)
+	root, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("error parsing page: %v", err)
+	}
+	sel := MustCompileSelector("span div div div div, span ~ div ~ div ~ div")
+
+	done := make(chan []*html.Node, 1)
+	go func() { done <- sel.MatchAll(root) }()
+	select {
+	case matches := <-done:
+		if len(matches) != 0 {
+			t.Errorf("expected no matches but got %d", len(matches))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("matching deeply nested elements took too long\nHINT: backtracking should be memoized")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if matches, err := sel.MatchAllContext(ctx, root); err != context.Canceled || matches != nil {
+		t.Errorf("expected matching to stop when the context is done, but got %d matches, %v", len(matches), err)
+	}
+}
+
+func TestCompileSelectorErrors(t *testing.T) {
+	for _, s := range []string{"", "div >", "a[href", "a[href=]", ":hover", "p:nth-child(x)", "div,", "#", `a[title="x]`, "p::before", "*|title"} {
+		if _, err := CompileSelector(s); err == nil {
+			t.Errorf("selector %q: expected an error but didn't get one", s)
+		}
+	}
+}
+
+func TestSelectorComplexity(t *testing.T) {
+	cases := map[string]int{
+		"p":                1,
+		"div.note > p":     4,
+		"a, b":             2,
+		"p:not(.a.b)":      3,
+		"ul li:last-child": 4,
+	}
+	for s, expected := range cases {
+		if actual := MustCompileSelector(s).Complexity(); actual != expected {
+			t.Errorf("selector %q: expected complexity %d but got %d", s, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package summary
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+//maxSitemapBytes limits the uncompressed size of a sitemap,
+//which the sitemaps protocol limits to 50MB.
+const maxSitemapBytes = 50 << 20
+
+//maxSitemapDepth limits how deeply sitemap indexes are followed.
+//The sitemaps protocol doesn't allow an index to list other indexes,
+//but some sites do anyway.
+const maxSitemapDepth = 3
+
+//sitemapDocument is a sitemap or a sitemap index.
+type sitemapDocument struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+//parseSitemap parses a sitemap or sitemap index, which may be gzipped,
+//and returns the page URLs and sitemap URLs it lists.
+func parseSitemap(data []byte) (pages []string, sitemaps []string, err error) {
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err = io.ReadAll(io.LimitReader(gz, maxSitemapBytes))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	doc := &sitemapDocument{}
+	if err := xml.Unmarshal(data, doc); err != nil {
+		return nil, nil, err
+	}
+	for _, u := range doc.URLs {
+		if loc := strings.TrimSpace(u.Loc); len(loc) > 0 {
+			pages = append(pages, loc)
+		}
+	}
+	for _, s := range doc.Sitemaps {
+		if loc := strings.TrimSpace(s.Loc); len(loc) > 0 {
+			sitemaps = append(sitemaps, loc)
+		}
+	}
+	return pages, sitemaps, nil
+}
+
+//fetchSitemap fetches and parses the sitemap at `sitemapURL`. Sitemaps
+//may be larger than MaxBytes, up to maxSitemapBytes.
+func (f *Fetcher) fetchSitemap(ctx context.Context, sitemapURL string) (pages []string, sitemaps []string, err error) {
+	page, err := f.fetch(ctx, sitemapURL, nil, maxSitemapBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer page.Body.Close()
+	data, err := io.ReadAll(page.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseSitemap(data)
+}
+
+//SitemapURLs returns the page URLs listed in the sitemaps of the site
+//at `siteURL`. The sitemaps are those listed in the site's robots.txt,
+//or /sitemap.xml if it lists none. Sitemap indexes are followed, and
+//only pages on the site's host are returned, at most `max` of them if
+//`max` is positive. The sitemaps read are also returned. Errors reading
+//individual sitemaps are returned along with the pages that were found.
+func (f *Fetcher) SitemapURLs(ctx context.Context, siteURL string, max int) (pages []string, sitemaps []string, errs []error) {
+	site, err := url.Parse(siteURL)
+	if err == nil {
+		err = checkUpstreamURL(site)
+	}
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	robotsSite, robots, err := f.robotsRules(ctx, site)
+	if err == nil {
+		f.robotsCache.done(robotsSite)
+	}
+	queue := append([]string{}, robots.sitemaps...)
+	if len(queue) == 0 {
+		queue = []string{site.ResolveReference(&url.URL{Path: "/sitemap.xml"}).String()}
+	}
+
+	seenSitemaps := map[string]bool{}
+	seenPages := map[string]bool{}
+	depth := map[string]int{}
+	for len(queue) > 0 && (max <= 0 || len(pages) < max) {
+		sitemapURL := queue[0]
+		queue = queue[1:]
+		if seenSitemaps[sitemapURL] {
+			continue
+		}
+		seenSitemaps[sitemapURL] = true
+		if !sameHost(sitemapURL, site) {
+			errs = append(errs, fmt.Errorf("%s: sitemap isn't on the site's host", sitemapURL))
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return pages, sitemaps, append(errs, err)
+		}
+		found, children, err := f.fetchSitemap(ctx, sitemapURL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", sitemapURL, err))
+			continue
+		}
+		sitemaps = append(sitemaps, sitemapURL)
+		for _, page := range found {
+			if !seenPages[page] && sameHost(page, site) && (max <= 0 || len(pages) < max) {
+				seenPages[page] = true
+				pages = append(pages, page)
+			}
+		}
+		if depth[sitemapURL] < maxSitemapDepth {
+			for _, child := range children {
+				if _, ok := depth[child]; !ok {
+					depth[child] = depth[sitemapURL] + 1
+				}
+				queue = append(queue, child)
+			}
+		}
+	}
+	return pages, sitemaps, errs
+}
+
+//sameHost reports whether `rawURL` is on the same host as `site`.
+func sameHost(rawURL string, site *url.URL) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && strings.EqualFold(u.Host, site.Host)
+}
@@ -0,0 +1,176 @@
+//Package summary extracts summary meta-data, such as the title,
+//description and preview images, from web pages and other documents.
+//
+//Extract reads the summary of an HTML document from any io.Reader.
+//A Fetcher fetches URLs safely and summarizes whatever they point to,
+//including PDFs, images, audio and video.
+package summary
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+
+	"golang.org/x/net/html"
+)
+
+//PreviewImage represents a preview image for a page
+type PreviewImage struct {
+	URL       string `json:"url,omitempty"`
+	SecureURL string `json:"secureURL,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	Alt       string `json:"alt,omitempty"`
+	Color     string `json:"color,omitempty"`
+	BlurHash  string `json:"blurHash,omitempty"`
+}
+
+//PageSummary represents summary properties for a web page
+type PageSummary struct {
+	Type        string          `json:"type,omitempty"`
+	URL         string          `json:"url,omitempty"`
+	Title       string          `json:"title,omitempty"`
+	SiteName    string          `json:"siteName,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Author      string          `json:"author,omitempty"`
+	Keywords    []string        `json:"keywords,omitempty"`
+	Icon        *PreviewImage   `json:"icon,omitempty"`
+	Images      []*PreviewImage `json:"images,omitempty"`
+	ContentType string          `json:"contentType,omitempty"`
+	Size        int64           `json:"size,omitempty"`
+	Created     string          `json:"created,omitempty"`
+	PageCount   int             `json:"pageCount,omitempty"`
+	Provenance  Provenance      `json:"provenance,omitempty"`
+	Values      Values          `json:"values,omitempty"`
+}
+
+//Values are the answers to the ad-hoc queries in Options.Queries,
+//keyed by query name. Queries that found nothing are left out.
+type Values map[string][]string
+
+//DefaultMaxBytes is the default limit on how much of a document
+//Extract reads, and how much of a response body a Fetcher reads.
+const DefaultMaxBytes int64 = 10 << 20
+
+//Options control how Extract reads a document.
+//A nil *Options uses the defaults.
+type Options struct {
+	//MaxBytes limits how much of the document is read.
+	//Zero means DefaultMaxBytes.
+	MaxBytes int64
+	//Registry is the extractors to use.
+	//Nil means the extractors of DefaultRegistry.
+	Registry *Registry
+	//Provenance records where each field's value came from,
+	//and the alternatives seen, in the summary's Provenance.
+	Provenance bool
+	//Queries are named ad-hoc queries for other parts of the page,
+	//such as a price or version number. Their answers are in the
+	//summary's Values.
+	Queries map[string]*FieldRule
+}
+
+//maxBytes returns the effective MaxBytes of `opts`.
+func (opts *Options) maxBytes() int64 {
+	if opts == nil || opts.MaxBytes <= 0 {
+		return DefaultMaxBytes
+	}
+	return opts.MaxBytes
+}
+
+//cacheable reports whether summaries extracted with `opts` can be
+//cached, which they can't if they have provenance or query values.
+func (opts *Options) cacheable() bool {
+	return opts == nil || (!opts.Provenance && len(opts.Queries) == 0)
+}
+
+//registry returns the effective Registry of `opts`.
+func (opts *Options) registry() *Registry {
+	if opts == nil || opts.Registry == nil {
+		return defaultRegistry
+	}
+	return opts.Registry
+}
+
+//Extract parses the HTML document read from `r` and returns its summary
+//meta-data, as found by the extractors in the options' registry. Relative
+//URLs in the document are resolved against `baseURL`, which is normally
+//the URL the document was fetched from. Extract returns ctx.Err() if
+//`ctx` is done before it finishes.
+func Extract(ctx context.Context, r io.Reader, baseURL string, opts *Options) (*PageSummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(r, opts.maxBytes()))
+	if err != nil {
+		return nil, err
+	}
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		//the parser gives up on pathological bodies, such as ones nested
+		//more than 512 elements deep, so fall back to just the <head>
+		//rather than losing its meta-data too
+		if root, err = html.Parse(bytes.NewReader(headPrefix(data))); err != nil {
+			return nil, err
+		}
+	}
+	doc := &Document{Root: root, URL: baseURL, ctx: ctx}
+
+	candidates := newCandidates()
+	for _, e := range opts.registry().Extractors() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		candidates.source = e.Name()
+		e.Extract(doc, candidates)
+	}
+	summary := candidates.Summary()
+	if opts != nil && opts.Provenance {
+		summary.Provenance = candidates.Provenance()
+	}
+	if opts != nil && len(opts.Queries) > 0 {
+		summary.Values = Values{}
+		for name, query := range opts.Queries {
+			if values := query.Values(doc); len(values) > 0 {
+				summary.Values[name] = values
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+//headPrefix returns the part of the HTML document in `data` that comes
+//before the end of its <head>, or the start of its <body>.
+func headPrefix(data []byte) []byte {
+	tokenizer := html.NewTokenizer(bytes.NewReader(data))
+	offset := 0
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			return data
+		}
+		name, _ := tokenizer.TagName()
+		if (tokenType == html.EndTagToken && string(name) == "head") ||
+			(tokenType == html.StartTagToken && string(name) == "body") {
+			return data[:offset]
+		}
+		offset += len(tokenizer.Raw())
+	}
+}
+
+func getAbsoluteURL(absoluteBase string, relative string) string {
+	absoluteURL, err := url.Parse(absoluteBase)
+	if err != nil {
+		return relative
+	}
+	relativeURL, err := url.Parse(relative)
+	if err != nil {
+		return relative
+	}
+	return absoluteURL.ResolveReference(relativeURL).String()
+}
@@ -0,0 +1,35 @@
+package summary
+
+//TwitterExtractor reads Twitter card <meta name="twitter:..."> elements,
+//which many pages have instead of, or as well as, Open Graph properties.
+//See https://developer.twitter.com/en/docs/twitter-for-websites/cards.
+type TwitterExtractor struct{}
+
+//twitterFields maps Twitter card properties to the fields they set.
+var twitterFields = map[string]Field{
+	"twitter:title":       FieldTitle,
+	"twitter:description": FieldDescription,
+}
+
+//Name returns "twitter".
+func (TwitterExtractor) Name() string { return "twitter" }
+
+//Extract adds the Twitter card properties of `doc` to `c`.
+func (TwitterExtractor) Extract(doc *Document, c *Candidates) {
+	var recentImage *PreviewImage
+	for _, meta := range metaElements(doc) {
+		if field, found := twitterFields[meta.Key]; found {
+			c.Add(field, meta.Content, meta.Tag)
+			continue
+		}
+		switch meta.Key {
+		case "twitter:image", "twitter:image:src":
+			recentImage = &PreviewImage{URL: doc.ResolveURL(meta.Content)}
+			c.AddImage(FieldImages, recentImage, meta.Tag)
+		case "twitter:image:alt":
+			if recentImage != nil {
+				recentImage.Alt = meta.Content
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package summary
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+//upstreamTimeout limits the total time of a request to an upstream server.
+const upstreamTimeout = 30 * time.Second
+
+//maxUpstreamRedirects limits how many redirects we follow.
+const maxUpstreamRedirects = 10
+
+//ErrInvalidURL is wrapped by the errors for URLs that can't be fetched,
+//such as ones that aren't http or https, or that resolve to
+//non-public addresses.
+var ErrInvalidURL = errors.New("invalid URL")
+
+//errPrivateAddress is returned when a request would connect to a
+//non-public address and AllowPrivateAddresses is off.
+var errPrivateAddress = fmt.Errorf("%w: connecting to non-public addresses is not allowed", ErrInvalidURL)
+
+//carrierGradeNAT is the shared address space of RFC 6598,
+//which net.IP.IsPrivate doesn't include.
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+//newUpstreamClient returns the HTTP client a Fetcher uses for every
+//request to an upstream server. Its dialer checks the resolved address of
+//every connection, including those made for redirects, so DNS tricks can't
+//get around it. Private addresses are allowed only while allowPrivate
+//returns true.
+func newUpstreamClient(allowPrivate func() bool) *http.Client {
+	return &http.Client{
+		Timeout: upstreamTimeout,
+		Transport: &http.Transport{
+			//don't let a proxy make connections on our behalf
+			Proxy: nil,
+			DialContext: (&net.Dialer{
+				Timeout: 10 * time.Second,
+				Control: func(network string, address string, c syscall.RawConn) error {
+					if allowPrivate() {
+						return nil
+					}
+					return checkUpstreamAddress(network, address, c)
+				},
+			}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 15 * time.Second,
+			MaxIdleConnsPerHost:   4,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxUpstreamRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxUpstreamRedirects)
+			}
+			return checkUpstreamURL(req.URL)
+		},
+	}
+}
+
+//checkUpstreamURL returns an error if `u` isn't an http or https URL.
+func checkUpstreamURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: unsupported URL scheme %q: must be http or https", ErrInvalidURL, u.Scheme)
+	}
+	if len(u.Host) == 0 {
+		return fmt.Errorf("%w: URL %q has no host", ErrInvalidURL, u.String())
+	}
+	return nil
+}
+
+//checkUpstreamAddress is the dialer's Control function. It runs after DNS
+//resolution and rejects connections to non-public IP addresses.
+func checkUpstreamAddress(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%s: %w", address, errPrivateAddress)
+	}
+	return nil
+}
+
+//isPublicIP reports whether `ip` is a globally routable unicast address.
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		carrierGradeNAT.Contains(ip) || ip.Equal(net.IPv4bcast))
+}
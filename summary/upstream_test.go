@@ -0,0 +1,117 @@
+package summary
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//newTestFetcher returns a Fetcher that can fetch pages
+//from local httptest servers.
+func newTestFetcher() *Fetcher {
+	f := NewFetcher()
+	f.AllowPrivateAddresses = true
+	return f
+}
+
+func TestFetchPageProtections(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(strings.Repeat("x", 2000)))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		name        string
+		hint        string
+		URL         string
+		allowLocal  bool
+		expectError bool
+	}{
+		{
+			"Loopback Address",
+			"Requests to loopback addresses should be refused",
+			server.URL,
+			false,
+			true,
+		},
+		{
+			"Loopback Address Allowed",
+			"AllowPrivateAddresses should allow requests to loopback addresses",
+			server.URL,
+			true,
+			false,
+		},
+		{
+			"Non-HTTP Scheme",
+			"Only http and https URLs should be fetched",
+			"file:///etc/passwd",
+			true,
+			true,
+		},
+		{
+			"Redirect to Non-HTTP Scheme",
+			"Redirects should be checked too",
+			server.URL + "/redirect",
+			true,
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		fetcher := NewFetcher()
+		fetcher.AllowPrivateAddresses = c.allowLocal
+		page, err := fetcher.Fetch(context.Background(), c.URL)
+		if err != nil && !c.expectError {
+			t.Errorf("case %s: unexpected error %v\nHINT: %s", c.name, err, c.hint)
+		}
+		if c.expectError && err == nil {
+			t.Errorf("case %s: expected error but didn't get one\nHINT: %s", c.name, c.hint)
+		}
+		if page != nil {
+			page.Body.Close()
+		}
+	}
+
+	fetcher := newTestFetcher()
+	fetcher.MaxBytes = 1000
+	page, err := fetcher.Fetch(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching page: %v", err)
+	}
+	defer page.Body.Close()
+	data, _ := io.ReadAll(page.Body)
+	if len(data) != 1000 {
+		t.Errorf("expected the response body to be limited to %d bytes but read %d", 1000, len(data))
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	cases := map[string]bool{
+		"93.184.216.34":    true,
+		"2606:2800::1":     true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::1":              false,
+		"fd00::1":          false,
+		"::ffff:127.0.0.1": false,
+	}
+	for ip, expected := range cases {
+		if actual := isPublicIP(net.ParseIP(ip)); actual != expected {
+			t.Errorf("isPublicIP(%s): expected %t but got %t", ip, expected, actual)
+		}
+	}
+}